@@ -0,0 +1,152 @@
+// Package api serves a JSON-over-HTTP interface for controlling a running
+// RapidTorrent instance, along with Transmission RPC and qBittorrent Web API
+// compatible endpoints, a browser UI and file streaming.
+package api
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"main/model"
+)
+
+type Server struct {
+	m         *model.Model
+	mux       *http.ServeMux
+	sessionID string
+	auth      authState
+	// bindIP is the address the listener is bound to, and exposed is set
+	// when it accepts connections from other hosts.
+	bindIP  net.IP
+	exposed bool
+}
+
+// NewServer creates the handler for the connections accepted by l, a listener
+// opened by Listen.
+func NewServer(m *model.Model, l net.Listener) *Server {
+	s := &Server{m: m, mux: http.NewServeMux(), sessionID: newSessionID(), auth: newAuthState()}
+	if addr, ok := l.Addr().(*net.TCPAddr); ok {
+		s.bindIP = addr.IP
+		s.exposed = !addr.IP.IsLoopback()
+	}
+
+	s.mux.HandleFunc("GET /api/torrents", s.handleListTorrents)
+	s.mux.HandleFunc("POST /api/torrents", s.handleAddTorrent)
+	s.mux.HandleFunc("GET /api/torrents/{hash}", s.handleGetTorrent)
+	s.mux.HandleFunc("DELETE /api/torrents/{hash}", s.handleRemoveTorrent)
+	s.mux.HandleFunc("POST /api/torrents/{hash}/pause", s.handlePauseTorrent)
+	s.mux.HandleFunc("POST /api/torrents/{hash}/resume", s.handleResumeTorrent)
+	s.mux.HandleFunc("POST /api/torrents/{hash}/move", s.handleMoveTorrent)
+	s.mux.HandleFunc("POST /api/torrents/{hash}/sequential", s.handleSequentialTorrent)
+	s.mux.HandleFunc("GET /stream/{hash}", s.handleStreamPlaylist)
+	s.mux.HandleFunc("GET /stream/{hash}/{index}", s.handleStreamFile)
+	s.mux.HandleFunc("GET /api/config", s.handleGetConfig)
+	s.mux.HandleFunc("PUT /api/config", s.handleSetConfig)
+	s.mux.HandleFunc("GET /api/stats", s.handleStats)
+	s.mux.HandleFunc("GET /api/events", s.handleEvents)
+	s.mux.Handle("GET /", webHandler())
+
+	s.mux.HandleFunc("POST /transmission/rpc", s.handleTransmission)
+
+	s.mux.HandleFunc("POST /api/v2/auth/login", s.handleQBLogin)
+	s.mux.HandleFunc("POST /api/v2/auth/logout", s.handleQBLogout)
+	s.mux.HandleFunc("GET /api/v2/app/version", s.handleQBVersion)
+	s.mux.HandleFunc("GET /api/v2/app/webapiVersion", s.handleQBWebAPIVersion)
+	s.mux.HandleFunc("GET /api/v2/app/preferences", s.handleQBPreferences)
+	s.mux.HandleFunc("POST /api/v2/app/setPreferences", s.handleQBSetPreferences)
+	s.mux.HandleFunc("GET /api/v2/torrents/info", s.handleQBTorrentsInfo)
+	s.mux.HandleFunc("POST /api/v2/torrents/add", s.handleQBTorrentsAdd)
+	s.mux.HandleFunc("GET /api/v2/torrents/categories", s.handleQBCategories)
+	s.mux.HandleFunc("POST /api/v2/torrents/createCategory", s.handleQBCreateCategory)
+	s.mux.HandleFunc("POST /api/v2/torrents/pause", s.handleQBTorrentsPause)
+	s.mux.HandleFunc("POST /api/v2/torrents/stop", s.handleQBTorrentsPause)
+	s.mux.HandleFunc("POST /api/v2/torrents/resume", s.handleQBTorrentsResume)
+	s.mux.HandleFunc("POST /api/v2/torrents/start", s.handleQBTorrentsResume)
+	s.mux.HandleFunc("POST /api/v2/torrents/delete", s.handleQBTorrentsDelete)
+	s.mux.HandleFunc("POST /api/v2/torrents/toggleSequentialDownload", s.handleQBToggleSequential)
+	s.mux.HandleFunc("POST /api/v2/torrents/toggleFirstLastPiecePrio", s.handleQBToggleSequential)
+	s.mux.HandleFunc("POST /api/v2/torrents/topPrio", s.handleQBTopPrio)
+	s.mux.HandleFunc("POST /api/v2/torrents/increasePrio", s.handleQBIncreasePrio)
+	s.mux.HandleFunc("POST /api/v2/torrents/decreasePrio", s.handleQBDecreasePrio)
+	s.mux.HandleFunc("POST /api/v2/torrents/bottomPrio", s.handleQBBottomPrio)
+	s.mux.HandleFunc("GET /api/v2/transfer/info", s.handleQBTransferInfo)
+	s.mux.HandleFunc("GET /api/v2/transfer/speedLimitsMode", s.handleQBSpeedLimitsMode)
+	s.mux.HandleFunc("POST /api/v2/transfer/toggleSpeedLimitsMode", s.handleQBToggleSpeedLimitsMode)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.checkOrigin(w, r) || !s.authorize(w, r) {
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Listen opens the listener for the API. An address of the form
+// "unix:/path/to/socket" listens on a Unix socket only the current user can
+// access, anything else is a host:port, which must be on the loopback
+// interface unless a password or API token is configured. With TLS enabled,
+// TCP connections are wrapped in TLS.
+func Listen(addr string, cfg model.Config) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		// A socket left behind by an unclean shutdown would fail the listen.
+		os.Remove(path)
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0o600); err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if !isLoopback(host) && !cfg.AuthEnabled() {
+		return nil, fmt.Errorf("refusing to listen on %s: set a web password or API token to allow non-loopback addresses", addr)
+	}
+
+	var tc *tls.Config
+	if cfg.TLS {
+		if tc, err = tlsConfig(cfg); err != nil {
+			return nil, fmt.Errorf("failed to set up TLS: %v", err)
+		}
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tc != nil {
+		l = tls.NewListener(l, tc)
+	}
+	return l, nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"crypto/sha256"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// lockoutDuration is how long a client is refused after too many failed
+	// logins.
+	lockoutDuration = 15 * time.Minute
+	// sessionTimeout is how long an idle login session stays valid.
+	sessionTimeout = time.Hour
+)
+
+type loginFailures struct {
+	count       int
+	lockedUntil time.Time
+}
+
+// authState keeps login sessions and failed login counts in memory.
+type authState struct {
+	mu       sync.Mutex
+	sessions map[string]time.Time
+	failures map[string]*loginFailures
+	// verified caches checked Basic credentials by their digest, mapped to
+	// the password hash they matched, so bcrypt doesn't run on every request.
+	verified map[[sha256.Size]byte]string
+}
+
+func newAuthState() authState {
+	return authState{
+		sessions: make(map[string]time.Time),
+		failures: make(map[string]*loginFailures),
+		verified: make(map[[sha256.Size]byte]string),
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// isUnixSocket reports whether r came in over the Unix socket, which only the
+// owner can connect to and so needs no credentials.
+func isUnixSocket(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
+
+func (s *Server) lockedOut(ip string) bool {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	f, ok := s.auth.failures[ip]
+	return ok && time.Now().Before(f.lockedUntil)
+}
+
+// recordLogin counts a failed login from ip, locking it out once the
+// configured number of attempts is reached, or forgets earlier failures after
+// a successful one.
+func (s *Server) recordLogin(ip string, ok bool) {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	if ok {
+		delete(s.auth.failures, ip)
+		return
+	}
+
+	f, exists := s.auth.failures[ip]
+	if !exists {
+		f = &loginFailures{}
+		s.auth.failures[ip] = f
+	}
+	f.count++
+	if limit := s.m.ConfigSnapshot().LoginAttempts; limit > 0 && f.count >= limit {
+		f.count = 0
+		f.lockedUntil = time.Now().Add(lockoutDuration)
+	}
+}
+
+func (s *Server) checkPassword(username, password string) bool {
+	cfg := s.m.ConfigSnapshot()
+	digest := sha256.Sum256([]byte(username + "\x00" + password))
+
+	s.auth.mu.Lock()
+	hash, cached := s.auth.verified[digest]
+	s.auth.mu.Unlock()
+	if cached && hash == cfg.AuthPassword && username == cfg.AuthUsername {
+		return true
+	}
+
+	if !cfg.CheckPassword(username, password) {
+		return false
+	}
+	s.auth.mu.Lock()
+	s.auth.verified[digest] = cfg.AuthPassword
+	s.auth.mu.Unlock()
+	return true
+}
+
+// login checks a username and password sent to a login form and starts a
+// session if they are right.
+func (s *Server) login(ip, username, password string) (string, bool) {
+	ok := s.checkPassword(username, password)
+	s.recordLogin(ip, ok)
+	if !ok {
+		return "", false
+	}
+
+	sid := newSessionID()
+	s.auth.mu.Lock()
+	s.auth.sessions[sid] = time.Now().Add(sessionTimeout)
+	s.auth.mu.Unlock()
+	return sid, true
+}
+
+func (s *Server) logout(sid string) {
+	s.auth.mu.Lock()
+	delete(s.auth.sessions, sid)
+	s.auth.mu.Unlock()
+}
+
+// validSession reports whether sid is a live session, extending it if so.
+func (s *Server) validSession(sid string) bool {
+	s.auth.mu.Lock()
+	defer s.auth.mu.Unlock()
+
+	expires, ok := s.auth.sessions[sid]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expires) {
+		delete(s.auth.sessions, sid)
+		return false
+	}
+	s.auth.sessions[sid] = time.Now().Add(sessionTimeout)
+	return true
+}
+
+// authorize checks the credentials of a request once a password or API token
+// is configured. It accepts an API token (as a Bearer token or X-API-Token
+// header), Basic credentials, a session cookie or, for streams, the stream
+// token of the torrent, and writes the response itself if the request is
+// refused.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if isUnixSocket(r) {
+		return true
+	}
+	cfg := s.m.ConfigSnapshot()
+	if !cfg.AuthEnabled() {
+		// Listen only opens a listener to other hosts with credentials set,
+		// clearing them afterwards leaves it to loopback clients.
+		if s.exposed && !isLoopback(clientIP(r)) {
+			http.Error(w, "set a web password or API token to allow access from other hosts", http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	// qBittorrent clients log in with a form, checked by the handler.
+	if r.URL.Path == "/api/v2/auth/login" {
+		return true
+	}
+
+	ip := clientIP(r)
+	if s.lockedOut(ip) {
+		http.Error(w, "too many failed logins, try again later", http.StatusTooManyRequests)
+		return false
+	}
+
+	token := r.Header.Get("X-API-Token")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = bearer
+	}
+	if token != "" {
+		ok := cfg.CheckToken(token)
+		s.recordLogin(ip, ok)
+		if ok {
+			return true
+		}
+	} else if username, password, ok := r.BasicAuth(); ok {
+		ok := s.checkPassword(username, password)
+		s.recordLogin(ip, ok)
+		if ok {
+			return true
+		}
+	} else if c, err := r.Cookie(qbCookieName); err == nil && s.validSession(c.Value) {
+		return true
+	} else if hash, ok := strings.CutPrefix(r.URL.Path, "/stream/"); ok && r.URL.Query().Has("token") {
+		hash, _, _ = strings.Cut(hash, "/")
+		ok := cfg.CheckStreamToken(hash, r.URL.Query().Get("token"))
+		s.recordLogin(ip, ok)
+		if ok {
+			return true
+		}
+	}
+
+	// qBittorrent clients expect a plain 403 when not logged in, everything
+	// else gets a Basic challenge so browsers ask for a password.
+	if strings.HasPrefix(r.URL.Path, "/api/v2/") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="RapidTorrent"`)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+// validHost reports whether the Host header of r names this server. A name
+// other than localhost may point anywhere, including this server from a page
+// on another site (DNS rebinding), so names are only accepted by a listener
+// open to other hosts that requires credentials.
+func (s *Server) validHost(r *http.Request) bool {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if isLoopback(host) {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return s.exposed && (s.bindIP.IsUnspecified() || ip.Equal(s.bindIP))
+	}
+	return s.exposed && s.m.ConfigSnapshot().AuthEnabled()
+}
+
+// checkOrigin refuses requests with a Host that doesn't name this server, and
+// requests that change anything sent by a page from another origin, which a
+// browser sends along with cached credentials. The origin is taken from the
+// Origin header, or else the Referer. It writes the response itself if the
+// request is refused.
+func (s *Server) checkOrigin(w http.ResponseWriter, r *http.Request) bool {
+	if isUnixSocket(r) {
+		return true
+	}
+	if !s.validHost(r) {
+		http.Error(w, "invalid Host header", http.StatusForbidden)
+		return false
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+	if u, err := url.Parse(source); err != nil || !strings.EqualFold(u.Host, r.Host) {
+		http.Error(w, "cross-origin request refused", http.StatusForbidden)
+		return false
+	}
+	return true
+}
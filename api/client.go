@@ -0,0 +1,144 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Client talks to the API of a running instance over its Unix socket.
+type Client struct {
+	socketPath string
+	http       *http.Client
+}
+
+func NewClient(socketPath string) *Client {
+	return &Client{
+		socketPath: socketPath,
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// do sends a request and decodes the JSON response into out, if given.
+func (c *Client) do(method, path, contentType string, body io.Reader, out any) error {
+	// The host is ignored, the transport always dials the socket.
+	req, err := http.NewRequest(method, "http://rapidtorrent"+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("no running instance found on %s: %v", c.socketPath, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error != "" {
+			return fmt.Errorf("%s", e.Error)
+		}
+		return fmt.Errorf("request failed: %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) Torrents() ([]TorrentStatus, error) {
+	var torrents []TorrentStatus
+	err := c.do(http.MethodGet, "/api/torrents", "", nil, &torrents)
+	return torrents, err
+}
+
+func (c *Client) Stats() (Stats, error) {
+	var stats Stats
+	err := c.do(http.MethodGet, "/api/stats", "", nil, &stats)
+	return stats, err
+}
+
+// AddMagnet adds a magnet link and returns the info hash of the torrent.
+func (c *Client) AddMagnet(uri string) (string, error) {
+	body, err := json.Marshal(map[string]string{"magnet": uri})
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		InfoHash string `json:"info_hash"`
+	}
+	err = c.do(http.MethodPost, "/api/torrents", "application/json", bytes.NewReader(body), &resp)
+	return resp.InfoHash, err
+}
+
+// AddTorrentFile uploads a local .torrent file and returns the info hash of
+// the torrent. Its data is stored in savePath, or in the download directory
+// if empty.
+func (c *Client) AddTorrentFile(path, savePath string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("torrent", filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return "", err
+	}
+	if savePath != "" {
+		if err := w.WriteField("save_path", savePath); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		InfoHash string `json:"info_hash"`
+	}
+	err = c.do(http.MethodPost, "/api/torrents", w.FormDataContentType(), &body, &resp)
+	return resp.InfoHash, err
+}
+
+func (c *Client) Pause(infoHash string) error {
+	return c.do(http.MethodPost, "/api/torrents/"+url.PathEscape(infoHash)+"/pause", "", nil, nil)
+}
+
+func (c *Client) Resume(infoHash string) error {
+	return c.do(http.MethodPost, "/api/torrents/"+url.PathEscape(infoHash)+"/resume", "", nil, nil)
+}
+
+func (c *Client) Remove(infoHash string, deleteData bool) error {
+	path := "/api/torrents/" + url.PathEscape(infoHash)
+	if deleteData {
+		path += "?delete_data=true"
+	}
+	return c.do(http.MethodDelete, path, "", nil, nil)
+}
@@ -0,0 +1,621 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"main/model"
+)
+
+// Versions reported to qBittorrent clients, which use them to pick the API
+// features they rely on.
+const (
+	qbAppVersion    = "v4.6.0"
+	qbWebAPIVersion = "2.9.3"
+	qbCookieName    = "SID"
+)
+
+// qbTorrent is an entry of /api/v2/torrents/info.
+type qbTorrent struct {
+	Hash          string  `json:"hash"`
+	Name          string  `json:"name"`
+	Size          int64   `json:"size"`
+	TotalSize     int64   `json:"total_size"`
+	Progress      float64 `json:"progress"`
+	DlSpeed       int64   `json:"dlspeed"`
+	UpSpeed       int64   `json:"upspeed"`
+	Downloaded    int64   `json:"downloaded"`
+	Uploaded      int64   `json:"uploaded"`
+	AmountLeft    int64   `json:"amount_left"`
+	Completed     int64   `json:"completed"`
+	Ratio         float64 `json:"ratio"`
+	RatioLimit    float64 `json:"ratio_limit"`
+	Eta           int64   `json:"eta"`
+	State         string  `json:"state"`
+	NumSeeds      int     `json:"num_seeds"`
+	NumLeechs     int     `json:"num_leechs"`
+	NumComplete   int     `json:"num_complete"`
+	NumIncomplete int     `json:"num_incomplete"`
+	SavePath      string  `json:"save_path"`
+	ContentPath   string  `json:"content_path"`
+	MagnetURI     string  `json:"magnet_uri"`
+	Category      string  `json:"category"`
+	Tags          string  `json:"tags"`
+	Priority      int64   `json:"priority"`
+	SeedingTime   int64   `json:"seeding_time"`
+	SeqDl         bool    `json:"seq_dl"`
+	FLPiecePrio   bool    `json:"f_l_piece_prio"`
+	DlLimit       int64   `json:"dl_limit"`
+	UpLimit       int64   `json:"up_limit"`
+}
+
+// qbState maps a torrent state onto the qBittorrent state names.
+func qbState(item *model.TorrentItem) string {
+	complete := item.Progress >= 100
+	switch item.State {
+	case "fetching_metadata":
+		return "metaDL"
+	case "connecting", "searching":
+		return "stalledDL"
+	case "downloading":
+		if item.Speed == 0 {
+			return "stalledDL"
+		}
+		return "downloading"
+	case "seeding", "completed":
+		if item.UploadSpeed == 0 {
+			return "stalledUP"
+		}
+		return "uploading"
+	case "finished":
+		return "pausedUP"
+	case "verifying":
+		if complete {
+			return "checkingUP"
+		}
+		return "checkingDL"
+	case "paused":
+		if complete {
+			return "pausedUP"
+		}
+		return "pausedDL"
+	case "queued":
+		if complete {
+			return "queuedUP"
+		}
+		return "queuedDL"
+	default:
+		return "unknown"
+	}
+}
+
+// qbFilters implements the "filter" parameter of /api/v2/torrents/info.
+var qbFilters = map[string]func(state string) bool{
+	"all": func(string) bool { return true },
+	"downloading": func(state string) bool {
+		return strings.HasSuffix(state, "DL") || state == "downloading"
+	},
+	"seeding": func(state string) bool {
+		return state == "uploading" || state == "stalledUP"
+	},
+	"completed": func(state string) bool {
+		return strings.HasSuffix(state, "UP") || state == "uploading"
+	},
+	"paused": func(state string) bool {
+		return strings.HasPrefix(state, "paused")
+	},
+	"resumed": func(state string) bool {
+		return !strings.HasPrefix(state, "paused")
+	},
+	"active": func(state string) bool {
+		return state == "downloading" || state == "uploading"
+	},
+	"inactive": func(state string) bool {
+		return state != "downloading" && state != "uploading"
+	},
+	"stalled": func(state string) bool {
+		return strings.HasPrefix(state, "stalled")
+	},
+	"checking": func(state string) bool {
+		return strings.HasPrefix(state, "checking")
+	},
+	"errored": func(string) bool { return false },
+}
+
+// qbSorts implements the "sort" parameter of /api/v2/torrents/info for the
+// fields clients commonly sort by.
+var qbSorts = map[string]func(a, b qbTorrent) bool{
+	"name":         func(a, b qbTorrent) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+	"size":         func(a, b qbTorrent) bool { return a.Size < b.Size },
+	"progress":     func(a, b qbTorrent) bool { return a.Progress < b.Progress },
+	"dlspeed":      func(a, b qbTorrent) bool { return a.DlSpeed < b.DlSpeed },
+	"upspeed":      func(a, b qbTorrent) bool { return a.UpSpeed < b.UpSpeed },
+	"ratio":        func(a, b qbTorrent) bool { return a.Ratio < b.Ratio },
+	"eta":          func(a, b qbTorrent) bool { return a.Eta < b.Eta },
+	"state":        func(a, b qbTorrent) bool { return a.State < b.State },
+	"priority":     func(a, b qbTorrent) bool { return a.Priority < b.Priority },
+	"seeding_time": func(a, b qbTorrent) bool { return a.SeedingTime < b.SeedingTime },
+}
+
+func (s *Server) qbTorrent(infoHash string, item *model.TorrentItem) qbTorrent {
+	t := item.Torrent
+	size := t.Length()
+	left := size - item.Downloaded
+	if left < 0 {
+		left = 0
+	}
+
+	eta := int64(8640000) // qBittorrent's "infinity"
+	if speed := bytesPerSecond(item.Speed); speed > 0 && left > 0 {
+		eta = left / speed
+	} else if left == 0 {
+		eta = 0
+	}
+
+	contentPath := item.SavePath
+	if t.Info() != nil {
+		contentPath = filepath.Join(item.SavePath, t.Info().BestName())
+	}
+
+	cfg := s.m.ConfigSnapshot()
+	return qbTorrent{
+		Hash:        infoHash,
+		Name:        item.Name,
+		Size:        size,
+		TotalSize:   size,
+		Progress:    item.Progress / 100,
+		DlSpeed:     bytesPerSecond(item.Speed),
+		UpSpeed:     bytesPerSecond(item.UploadSpeed),
+		Downloaded:  item.Downloaded,
+		Uploaded:    item.Uploaded,
+		AmountLeft:  left,
+		Completed:   item.Downloaded,
+		Ratio:       item.Ratio(),
+		RatioLimit:  cfg.SeedRatio,
+		Eta:         eta,
+		State:       qbState(item),
+		NumSeeds:    item.ActivePeers,
+		NumComplete: item.TotalPeers,
+		SavePath:    item.SavePath,
+		ContentPath: contentPath,
+		MagnetURI:   item.MagnetURI,
+		Category:    item.Label,
+		Priority:    int64(item.QueuePosition),
+		SeedingTime: int64(item.SeedingTime.Seconds()),
+		SeqDl:       item.Sequential,
+		FLPiecePrio: item.Sequential,
+		DlLimit:     cfg.DownloadLimit * 1024,
+		UpLimit:     cfg.UploadLimit * 1024,
+	}
+}
+
+// handleQBLogin checks the username and password form values and hands out
+// a session cookie. Without authentication configured any credentials are
+// accepted, like qBittorrent does for clients on localhost.
+func (s *Server) handleQBLogin(w http.ResponseWriter, r *http.Request) {
+	sid := newSessionID()
+	if s.m.ConfigSnapshot().AuthEnabled() && !isUnixSocket(r) {
+		ip := clientIP(r)
+		if s.lockedOut(ip) {
+			http.Error(w, "Your IP address has been banned after too many failed authentication attempts.", http.StatusForbidden)
+			return
+		}
+		var ok bool
+		if sid, ok = s.login(ip, r.FormValue("username"), r.FormValue("password")); !ok {
+			fmt.Fprint(w, "Fails.")
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: qbCookieName, Value: sid, Path: "/", HttpOnly: true})
+	fmt.Fprint(w, "Ok.")
+}
+
+func (s *Server) handleQBLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(qbCookieName); err == nil {
+		s.logout(c.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: qbCookieName, Path: "/", MaxAge: -1})
+}
+
+func (s *Server) handleQBVersion(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, qbAppVersion)
+}
+
+func (s *Server) handleQBWebAPIVersion(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, qbWebAPIVersion)
+}
+
+func (s *Server) handleQBTorrentsInfo(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter, ok := qbFilters[query.Get("filter")]
+	if !ok {
+		filter = qbFilters["all"]
+	}
+
+	var wanted map[string]bool
+	if hashes := query.Get("hashes"); hashes != "" {
+		wanted = make(map[string]bool)
+		for _, infoHash := range strings.Split(hashes, "|") {
+			wanted[strings.ToLower(infoHash)] = true
+		}
+	}
+
+	// Categories are the labels of the torrents. An empty category asks for
+	// the torrents without one.
+	category, byCategory := query["category"]
+
+	torrents := []qbTorrent{}
+	s.m.Mu.RLock()
+	for infoHash, item := range s.m.Torrents {
+		if wanted != nil && !wanted[infoHash] {
+			continue
+		}
+		if byCategory && item.Label != category[0] {
+			continue
+		}
+		if torrent := s.qbTorrent(infoHash, item); filter(torrent.State) {
+			torrents = append(torrents, torrent)
+		}
+	}
+	s.m.Mu.RUnlock()
+
+	sort.Slice(torrents, func(i, j int) bool { return torrents[i].Priority < torrents[j].Priority })
+	if less, ok := qbSorts[query.Get("sort")]; ok {
+		sort.SliceStable(torrents, func(i, j int) bool { return less(torrents[i], torrents[j]) })
+	}
+	if query.Get("reverse") == "true" {
+		for i, j := 0, len(torrents)-1; i < j; i, j = i+1, j-1 {
+			torrents[i], torrents[j] = torrents[j], torrents[i]
+		}
+	}
+
+	if offset, err := strconv.Atoi(query.Get("offset")); err == nil {
+		if offset < 0 {
+			offset += len(torrents)
+		}
+		if offset < 0 {
+			offset = 0
+		}
+		if offset > len(torrents) {
+			offset = len(torrents)
+		}
+		torrents = torrents[offset:]
+	}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 && limit < len(torrents) {
+		torrents = torrents[:limit]
+	}
+
+	writeJSON(w, http.StatusOK, torrents)
+}
+
+// handleQBTorrentsAdd adds the magnet links and URLs in "urls", one per
+// line, and the .torrent files uploaded as "torrents", with the category as
+// their label.
+func (s *Server) handleQBTorrentsAdd(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := model.AddOptions{
+		SavePath: r.FormValue("savepath"),
+		Label:    r.FormValue("category"),
+		Paused:   r.FormValue("paused") == "true" || r.FormValue("stopped") == "true",
+	}
+
+	var hashes []string
+	var failed bool
+	for _, u := range strings.Split(r.FormValue("urls"), "\n") {
+		if u = strings.TrimSpace(u); u == "" {
+			continue
+		}
+		infoHash, _, err := s.m.AddURL(u, opts)
+		if err != nil {
+			failed = true
+			continue
+		}
+		hashes = append(hashes, infoHash)
+	}
+
+	if r.MultipartForm != nil {
+		for _, fh := range r.MultipartForm.File["torrents"] {
+			f, err := fh.Open()
+			if err != nil {
+				failed = true
+				continue
+			}
+			infoHash, _, err := s.m.AddMetainfoWithOptions(f, opts)
+			f.Close()
+			if err != nil {
+				failed = true
+				continue
+			}
+			hashes = append(hashes, infoHash)
+		}
+	}
+
+	if failed || len(hashes) == 0 {
+		http.Error(w, "Fails.", http.StatusUnsupportedMediaType)
+		return
+	}
+	fmt.Fprint(w, "Ok.")
+}
+
+// qbCategory is an entry of /api/v2/torrents/categories.
+type qbCategory struct {
+	Name     string `json:"name"`
+	SavePath string `json:"savePath"`
+}
+
+// handleQBCategories lists the labels with a directory configured and the
+// labels of the torrents as categories.
+func (s *Server) handleQBCategories(w http.ResponseWriter, r *http.Request) {
+	categories := make(map[string]qbCategory)
+	for _, dir := range s.m.ConfigSnapshot().LabelDirs {
+		categories[dir.Label] = qbCategory{Name: dir.Label, SavePath: dir.Path}
+	}
+
+	s.m.Mu.RLock()
+	for _, item := range s.m.Torrents {
+		if _, exists := categories[item.Label]; item.Label != "" && !exists {
+			categories[item.Label] = qbCategory{Name: item.Label}
+		}
+	}
+	s.m.Mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, categories)
+}
+
+// handleQBCreateCategory accepts any category name. Labels exist as soon as a
+// torrent has them, so there is nothing to create.
+func (s *Server) handleQBCreateCategory(w http.ResponseWriter, r *http.Request) {
+	if strings.TrimSpace(r.FormValue("category")) == "" {
+		http.Error(w, "Invalid category name", http.StatusBadRequest)
+	}
+}
+
+// qbHashes returns the torrents named by the "hashes" form value, which is
+// either "all" or a list of info hashes separated by "|".
+func (s *Server) qbHashes(r *http.Request) []string {
+	s.m.Mu.RLock()
+	defer s.m.Mu.RUnlock()
+
+	var hashes []string
+	value := r.FormValue("hashes")
+	if value == "all" {
+		for infoHash := range s.m.Torrents {
+			hashes = append(hashes, infoHash)
+		}
+		return hashes
+	}
+	for _, infoHash := range strings.Split(value, "|") {
+		infoHash = strings.ToLower(infoHash)
+		if _, exists := s.m.Torrents[infoHash]; exists {
+			hashes = append(hashes, infoHash)
+		}
+	}
+	return hashes
+}
+
+// qbAction runs an action on every torrent named in the request.
+func (s *Server) qbAction(w http.ResponseWriter, r *http.Request, action func(infoHash string) error) {
+	for _, infoHash := range s.qbHashes(r) {
+		if err := action(infoHash); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (s *Server) handleQBTorrentsPause(w http.ResponseWriter, r *http.Request) {
+	s.qbAction(w, r, s.m.PauseTorrent)
+}
+
+func (s *Server) handleQBTorrentsResume(w http.ResponseWriter, r *http.Request) {
+	s.qbAction(w, r, s.m.ResumeTorrent)
+}
+
+func (s *Server) handleQBTorrentsDelete(w http.ResponseWriter, r *http.Request) {
+	deleteFiles := r.FormValue("deleteFiles") == "true"
+	s.qbAction(w, r, func(infoHash string) error {
+		return s.m.RemoveTorrent(infoHash, deleteFiles)
+	})
+}
+
+// handleQBToggleSequential toggles sequential download, which includes the
+// first and last piece boost, so both toggles of qBittorrent map onto it.
+func (s *Server) handleQBToggleSequential(w http.ResponseWriter, r *http.Request) {
+	s.qbAction(w, r, func(infoHash string) error {
+		_, err := s.m.ToggleSequential(infoHash)
+		return err
+	})
+}
+
+func (s *Server) qbQueueMove(w http.ResponseWriter, r *http.Request, direction string) {
+	s.qbAction(w, r, func(infoHash string) error {
+		return s.m.MoveInQueue(infoHash, direction)
+	})
+}
+
+func (s *Server) handleQBTopPrio(w http.ResponseWriter, r *http.Request) {
+	s.qbQueueMove(w, r, model.QueueTop)
+}
+
+func (s *Server) handleQBIncreasePrio(w http.ResponseWriter, r *http.Request) {
+	s.qbQueueMove(w, r, model.QueueUp)
+}
+
+func (s *Server) handleQBDecreasePrio(w http.ResponseWriter, r *http.Request) {
+	s.qbQueueMove(w, r, model.QueueDown)
+}
+
+func (s *Server) handleQBBottomPrio(w http.ResponseWriter, r *http.Request) {
+	s.qbQueueMove(w, r, model.QueueBottom)
+}
+
+// handleQBSpeedLimitsMode reports 1 while the alternate speed limits are on.
+func (s *Server) handleQBSpeedLimitsMode(w http.ResponseWriter, r *http.Request) {
+	if s.m.ConfigSnapshot().AltSpeed {
+		fmt.Fprint(w, "1")
+	} else {
+		fmt.Fprint(w, "0")
+	}
+}
+
+func (s *Server) handleQBToggleSpeedLimitsMode(w http.ResponseWriter, r *http.Request) {
+	if err := s.m.SetAltSpeed(!s.m.ConfigSnapshot().AltSpeed); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) handleQBTransferInfo(w http.ResponseWriter, r *http.Request) {
+	download, upload := s.m.SpeedLimits()
+	info := map[string]any{
+		"connection_status": "connected",
+		"dht_nodes":         0,
+		"dl_rate_limit":     download * 1024,
+		"up_rate_limit":     upload * 1024,
+	}
+
+	var dlSpeed, upSpeed, dlData, upData int64
+	s.m.Mu.RLock()
+	for _, item := range s.m.Torrents {
+		dlSpeed += bytesPerSecond(item.Speed)
+		upSpeed += bytesPerSecond(item.UploadSpeed)
+		dlData += item.Downloaded
+		upData += item.Uploaded
+	}
+	s.m.Mu.RUnlock()
+
+	info["dl_info_speed"] = dlSpeed
+	info["up_info_speed"] = upSpeed
+	info["dl_info_data"] = dlData
+	info["up_info_data"] = upData
+	writeJSON(w, http.StatusOK, info)
+}
+
+// qbLimit converts a limit where 0 means unlimited to qBittorrent's -1.
+func qbLimit(n int) int {
+	if n <= 0 {
+		return -1
+	}
+	return n
+}
+
+func (s *Server) handleQBPreferences(w http.ResponseWriter, r *http.Request) {
+	cfg := s.m.ConfigSnapshot()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"save_path":                cfg.DownloadDir,
+		"temp_path_enabled":        cfg.IncompleteDir != "",
+		"temp_path":                cfg.IncompleteDir,
+		"listen_port":              cfg.ListenPort,
+		"max_connec_per_torrent":   cfg.MaxConnections,
+		"dl_limit":                 cfg.DownloadLimit * 1024,
+		"up_limit":                 cfg.UploadLimit * 1024,
+		"max_ratio_enabled":        cfg.SeedRatio > 0,
+		"max_ratio":                cfg.SeedRatio,
+		"max_seeding_time_enabled": cfg.SeedTime > 0,
+		"max_seeding_time":         cfg.SeedTime,
+		"max_ratio_act":            0,
+		"queueing_enabled":         cfg.MaxActiveDownloads > 0 || cfg.MaxActiveSeeds > 0,
+		"max_active_downloads":     qbLimit(cfg.MaxActiveDownloads),
+		"max_active_uploads":       qbLimit(cfg.MaxActiveSeeds),
+		"max_active_torrents":      -1,
+		"alt_dl_limit":             cfg.AltDownloadLimit * 1024,
+		"alt_up_limit":             cfg.AltUploadLimit * 1024,
+		"scheduler_enabled":        cfg.AltSpeedSchedule,
+	})
+}
+
+// handleQBSetPreferences applies the preferences in the "json" form value.
+// Limits are given in bytes per second and rounded to the KB/s that Config
+// keeps.
+func (s *Server) handleQBSetPreferences(w http.ResponseWriter, r *http.Request) {
+	var prefs struct {
+		SavePath              *string  `json:"save_path"`
+		TempPathEnabled       *bool    `json:"temp_path_enabled"`
+		TempPath              *string  `json:"temp_path"`
+		ListenPort            *int     `json:"listen_port"`
+		MaxConnecPerTorrent   *int     `json:"max_connec_per_torrent"`
+		DlLimit               *int64   `json:"dl_limit"`
+		UpLimit               *int64   `json:"up_limit"`
+		MaxRatioEnabled       *bool    `json:"max_ratio_enabled"`
+		MaxRatio              *float64 `json:"max_ratio"`
+		MaxSeedingTimeEnabled *bool    `json:"max_seeding_time_enabled"`
+		MaxSeedingTime        *int     `json:"max_seeding_time"`
+		QueueingEnabled       *bool    `json:"queueing_enabled"`
+		MaxActiveDownloads    *int     `json:"max_active_downloads"`
+		MaxActiveUploads      *int     `json:"max_active_uploads"`
+		AltDlLimit            *int64   `json:"alt_dl_limit"`
+		AltUpLimit            *int64   `json:"alt_up_limit"`
+		SchedulerEnabled      *bool    `json:"scheduler_enabled"`
+	}
+	if err := json.Unmarshal([]byte(r.FormValue("json")), &prefs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cfg := s.m.ConfigSnapshot()
+	if prefs.SavePath != nil {
+		cfg.DownloadDir = *prefs.SavePath
+	}
+	if prefs.TempPath != nil {
+		cfg.IncompleteDir = *prefs.TempPath
+	}
+	if prefs.TempPathEnabled != nil && !*prefs.TempPathEnabled {
+		cfg.IncompleteDir = ""
+	}
+	if prefs.ListenPort != nil {
+		cfg.ListenPort = *prefs.ListenPort
+	}
+	if prefs.MaxConnecPerTorrent != nil {
+		cfg.MaxConnections = *prefs.MaxConnecPerTorrent
+	}
+	if prefs.DlLimit != nil {
+		cfg.DownloadLimit = *prefs.DlLimit / 1024
+	}
+	if prefs.UpLimit != nil {
+		cfg.UploadLimit = *prefs.UpLimit / 1024
+	}
+	if prefs.MaxRatio != nil {
+		cfg.SeedRatio = *prefs.MaxRatio
+	}
+	if prefs.MaxRatioEnabled != nil && !*prefs.MaxRatioEnabled {
+		cfg.SeedRatio = 0
+	}
+	if prefs.MaxSeedingTime != nil {
+		cfg.SeedTime = *prefs.MaxSeedingTime
+	}
+	if prefs.MaxSeedingTimeEnabled != nil && !*prefs.MaxSeedingTimeEnabled {
+		cfg.SeedTime = 0
+	}
+	if prefs.MaxActiveDownloads != nil {
+		cfg.MaxActiveDownloads = max(*prefs.MaxActiveDownloads, 0)
+	}
+	if prefs.MaxActiveUploads != nil {
+		cfg.MaxActiveSeeds = max(*prefs.MaxActiveUploads, 0)
+	}
+	if prefs.QueueingEnabled != nil && !*prefs.QueueingEnabled {
+		cfg.MaxActiveDownloads = 0
+		cfg.MaxActiveSeeds = 0
+	}
+	if prefs.AltDlLimit != nil {
+		cfg.AltDownloadLimit = *prefs.AltDlLimit / 1024
+	}
+	if prefs.AltUpLimit != nil {
+		cfg.AltUploadLimit = *prefs.AltUpLimit / 1024
+	}
+	if prefs.SchedulerEnabled != nil {
+		cfg.AltSpeedSchedule = *prefs.SchedulerEnabled
+	}
+
+	if err := s.m.UpdateConfig(cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
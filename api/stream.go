@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"main/model"
+
+	"github.com/anacrolix/torrent"
+)
+
+// contextReader makes reads of a torrent give up when the request is
+// cancelled, instead of waiting for pieces that may never arrive.
+type contextReader struct {
+	torrent.Reader
+	ctx context.Context
+}
+
+func (r contextReader) Read(b []byte) (int, error) {
+	return r.ReadContext(r.ctx, b)
+}
+
+// BaseURL returns the URL the API served on addr is reached at, or "" for a
+// Unix socket, which media players can't stream from.
+func BaseURL(addr string, cfg model.Config) string {
+	if strings.HasPrefix(addr, "unix:") {
+		return ""
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	scheme := "http"
+	if cfg.TLS {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+// streamTorrent returns the torrent named in the request once its files are
+// known, or writes an error.
+func (s *Server) streamTorrent(w http.ResponseWriter, r *http.Request) (*torrent.Torrent, bool) {
+	infoHash := strings.ToLower(r.PathValue("hash"))
+
+	s.m.Mu.RLock()
+	item, exists := s.m.Torrents[infoHash]
+	s.m.Mu.RUnlock()
+	if !exists {
+		http.Error(w, fmt.Sprintf("torrent %s not found", infoHash), http.StatusNotFound)
+		return nil, false
+	}
+	if item.Torrent.Info() == nil {
+		http.Error(w, "torrent metadata is not available yet", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	return item.Torrent, true
+}
+
+// handleStreamPlaylist lists the files of a torrent as an M3U playlist of
+// stream URLs, which media players can open directly.
+func (s *Server) handleStreamPlaylist(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.streamTorrent(w, r)
+	if !ok {
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	// Players can't log in, so the entries carry the stream token instead.
+	var query string
+	if cfg := s.m.ConfigSnapshot(); cfg.AuthEnabled() {
+		query = "?token=" + cfg.StreamToken(t.InfoHash().String())
+	}
+
+	w.Header().Set("Content-Type", "audio/x-mpegurl")
+	fmt.Fprintln(w, "#EXTM3U")
+	for i, f := range t.Files() {
+		fmt.Fprintf(w, "#EXTINF:-1,%s\n%s://%s/stream/%s/%d%s\n", f.DisplayPath(), scheme, r.Host, t.InfoHash(), i, query)
+	}
+}
+
+// handleStreamFile serves a file of a torrent with Range support. Reads are
+// served from the torrent, so the pieces a player asks for are fetched
+// first, whether or not they were downloaded yet.
+func (s *Server) handleStreamFile(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.streamTorrent(w, r)
+	if !ok {
+		return
+	}
+
+	files := t.Files()
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 || index >= len(files) {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	f := files[index]
+
+	reader := f.NewReader()
+	defer reader.Close()
+	reader.SetResponsive()
+
+	http.ServeContent(w, r, path.Base(f.DisplayPath()), time.Time{}, contextReader{reader, r.Context()})
+}
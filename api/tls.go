@@ -0,0 +1,104 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"main/model"
+)
+
+// selfSignedPaths returns where the self-signed certificate and its key are
+// kept, in the state directory next to the database, so clients that pinned
+// it keep working across restarts.
+func selfSignedPaths() (certFile, keyFile string, err error) {
+	if certFile, err = model.StateFile("rapidtorrent.crt"); err != nil {
+		return "", "", err
+	}
+	if keyFile, err = model.StateFile("rapidtorrent.key"); err != nil {
+		return "", "", err
+	}
+	// A key moved over from the working directory may be readable by others.
+	if err := os.Chmod(keyFile, 0o600); err != nil && !os.IsNotExist(err) {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+// tlsConfig loads the configured certificate, or a self-signed one if none is
+// configured.
+func tlsConfig(cfg model.Config) (*tls.Config, error) {
+	certFile, keyFile := cfg.TLSCert, cfg.TLSKey
+	if certFile == "" {
+		var err error
+		if certFile, keyFile, err = selfSignedPaths(); err != nil {
+			return nil, err
+		}
+		if err := ensureSelfSigned(certFile, keyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ensureSelfSigned creates a self-signed certificate for localhost and this
+// machine's hostname, unless one exists already.
+func ensureSelfSigned(certFile, keyFile string) error {
+	if _, err := os.Stat(certFile); err == nil {
+		return nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	hosts := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil {
+		hosts = append(hosts, hostname)
+	}
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "RapidTorrent"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              hosts,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+}
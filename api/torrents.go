@@ -0,0 +1,329 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+
+	"main/model"
+)
+
+type TorrentStatus struct {
+	InfoHash      string  `json:"info_hash"`
+	Name          string  `json:"name"`
+	State         string  `json:"state"`
+	Progress      float64 `json:"progress"`
+	Size          int64   `json:"size"`
+	Downloaded    int64   `json:"downloaded"`
+	Uploaded      int64   `json:"uploaded"`
+	Ratio         float64 `json:"ratio"`
+	DownloadSpeed int64   `json:"download_speed"`
+	UploadSpeed   int64   `json:"upload_speed"`
+	ActivePeers   int     `json:"active_peers"`
+	TotalPeers    int     `json:"total_peers"`
+	SeedingTime   int64   `json:"seeding_time"`
+	SavePath      string  `json:"save_path"`
+	CompletedPath string  `json:"completed_path,omitempty"`
+	Label         string  `json:"label"`
+	QueuePosition int     `json:"queue_position"`
+	Sequential    bool    `json:"sequential"`
+	MagnetURI     string  `json:"magnet_uri"`
+}
+
+type FileStatus struct {
+	Path       string  `json:"path"`
+	Size       int64   `json:"size"`
+	Progress   float64 `json:"progress"`
+	Priority   string  `json:"priority"`
+	Downloaded int64   `json:"downloaded"`
+}
+
+type PeerStatus struct {
+	Address       string `json:"address"`
+	Client        string `json:"client"`
+	DownloadSpeed int64  `json:"download_speed"`
+	Source        string `json:"source"`
+	Network       string `json:"network"`
+	Encrypted     bool   `json:"encrypted"`
+}
+
+type TorrentDetails struct {
+	TorrentStatus
+	Files    []FileStatus          `json:"files"`
+	Peers    []PeerStatus          `json:"peers"`
+	Trackers []model.TrackerStatus `json:"trackers"`
+}
+
+type Stats struct {
+	Torrents      int            `json:"torrents"`
+	States        map[string]int `json:"states"`
+	DownloadSpeed int64          `json:"download_speed"`
+	UploadSpeed   int64          `json:"upload_speed"`
+	Downloaded    int64          `json:"downloaded"`
+	Uploaded      int64          `json:"uploaded"`
+	ActivePeers   int            `json:"active_peers"`
+	DownloadLimit int64          `json:"download_limit"`
+	UploadLimit   int64          `json:"upload_limit"`
+	AltSpeed      bool           `json:"alt_speed"`
+}
+
+// bytesPerSecond converts the MB/s speeds kept on TorrentItem.
+func bytesPerSecond(mbps float64) int64 {
+	return int64(mbps * 1024 * 1024)
+}
+
+func torrentStatus(infoHash string, item *model.TorrentItem) TorrentStatus {
+	return TorrentStatus{
+		InfoHash:      infoHash,
+		Name:          item.Name,
+		State:         item.State,
+		Progress:      item.Progress,
+		Size:          item.Torrent.Length(),
+		Downloaded:    item.Downloaded,
+		Uploaded:      item.Uploaded,
+		Ratio:         item.Ratio(),
+		DownloadSpeed: bytesPerSecond(item.Speed),
+		UploadSpeed:   bytesPerSecond(item.UploadSpeed),
+		ActivePeers:   item.ActivePeers,
+		TotalPeers:    item.TotalPeers,
+		SeedingTime:   int64(item.SeedingTime.Seconds()),
+		SavePath:      item.SavePath,
+		CompletedPath: item.CompletedPath,
+		Label:         item.Label,
+		QueuePosition: item.QueuePosition,
+		Sequential:    item.Sequential,
+		MagnetURI:     item.MagnetURI,
+	}
+}
+
+func torrentDetails(infoHash string, item *model.TorrentItem) TorrentDetails {
+	details := TorrentDetails{
+		TorrentStatus: torrentStatus(infoHash, item),
+		Files:         []FileStatus{},
+		Peers:         []PeerStatus{},
+		Trackers:      item.Trackers,
+	}
+	if details.Trackers == nil {
+		details.Trackers = []model.TrackerStatus{}
+	}
+
+	t := item.Torrent
+	if t.Info() != nil {
+		for _, f := range t.Files() {
+			fs := FileStatus{
+				Path:       f.DisplayPath(),
+				Size:       f.Length(),
+				Downloaded: f.BytesCompleted(),
+				Priority:   model.FilePriorityName(f.Priority()),
+			}
+			if f.Length() > 0 {
+				fs.Progress = float64(fs.Downloaded) / float64(f.Length()) * 100
+			}
+			details.Files = append(details.Files, fs)
+		}
+	}
+
+	for _, pc := range t.PeerConns() {
+		client, _ := pc.PeerClientName.Load().(string)
+		details.Peers = append(details.Peers, PeerStatus{
+			Address:       pc.RemoteAddr.String(),
+			Client:        client,
+			DownloadSpeed: int64(pc.DownloadRate()),
+			Source:        string(pc.Discovery),
+			Network:       pc.Network,
+			Encrypted:     pc.PeerPrefersEncryption,
+		})
+	}
+
+	return details
+}
+
+// torrents returns the status of every torrent, sorted by name.
+func (s *Server) torrents() []TorrentStatus {
+	s.m.Mu.RLock()
+	torrents := make([]TorrentStatus, 0, len(s.m.Torrents))
+	for infoHash, item := range s.m.Torrents {
+		torrents = append(torrents, torrentStatus(infoHash, item))
+	}
+	s.m.Mu.RUnlock()
+
+	sort.Slice(torrents, func(i, j int) bool {
+		return torrents[i].Name < torrents[j].Name
+	})
+	return torrents
+}
+
+func (s *Server) handleListTorrents(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.torrents())
+}
+
+func (s *Server) handleGetTorrent(w http.ResponseWriter, r *http.Request) {
+	infoHash := r.PathValue("hash")
+
+	s.m.Mu.RLock()
+	item, exists := s.m.Torrents[infoHash]
+	var details TorrentDetails
+	if exists {
+		details = torrentDetails(infoHash, item)
+	}
+	s.m.Mu.RUnlock()
+
+	if !exists {
+		writeError(w, http.StatusNotFound, fmt.Errorf("torrent %s not found", infoHash))
+		return
+	}
+	writeJSON(w, http.StatusOK, details)
+}
+
+// handleAddTorrent adds a magnet link sent as JSON ({"magnet": "..."}) or a
+// .torrent file uploaded as the "torrent" field of a multipart form. Either
+// may give a "save_path" to store the data in instead of the configured
+// directories, and a "label".
+func (s *Server) handleAddTorrent(w http.ResponseWriter, r *http.Request) {
+	var infoHash string
+	var err error
+
+	// Other content types can be posted by any web page without a preflight.
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		var f io.ReadCloser
+		f, _, err = r.FormFile("torrent")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		defer f.Close()
+		infoHash, _, err = s.m.AddMetainfoWithOptions(f, model.AddOptions{SavePath: r.FormValue("save_path"), Label: r.FormValue("label")})
+	case "application/json":
+		var req struct {
+			Magnet   string `json:"magnet"`
+			SavePath string `json:"save_path"`
+			Label    string `json:"label"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Magnet == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("expected a JSON body with a magnet link"))
+			return
+		}
+		infoHash, _, err = s.m.AddMagnetWithOptions(req.Magnet, model.AddOptions{SavePath: req.SavePath, Label: req.Label})
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("expected application/json or multipart/form-data"))
+		return
+	}
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"info_hash": infoHash})
+}
+
+// torrentAction runs an action on the torrent named in the request path,
+// answering 404 if there is no such torrent.
+func (s *Server) torrentAction(w http.ResponseWriter, r *http.Request, action func(infoHash string) error) {
+	infoHash := r.PathValue("hash")
+
+	s.m.Mu.RLock()
+	_, exists := s.m.Torrents[infoHash]
+	s.m.Mu.RUnlock()
+	if !exists {
+		writeError(w, http.StatusNotFound, fmt.Errorf("torrent %s not found", infoHash))
+		return
+	}
+
+	if err := action(infoHash); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlePauseTorrent(w http.ResponseWriter, r *http.Request) {
+	s.torrentAction(w, r, s.m.PauseTorrent)
+}
+
+func (s *Server) handleResumeTorrent(w http.ResponseWriter, r *http.Request) {
+	s.torrentAction(w, r, s.m.ResumeTorrent)
+}
+
+// handleMoveTorrent moves a torrent in the queue in the direction given by
+// the "to" query parameter: top, up, down or bottom.
+func (s *Server) handleMoveTorrent(w http.ResponseWriter, r *http.Request) {
+	direction := r.URL.Query().Get("to")
+	switch direction {
+	case model.QueueTop, model.QueueUp, model.QueueDown, model.QueueBottom:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown queue direction %q", direction))
+		return
+	}
+	s.torrentAction(w, r, func(infoHash string) error {
+		return s.m.MoveInQueue(infoHash, direction)
+	})
+}
+
+// handleSequentialTorrent turns sequential download on, or off if the
+// "enabled" query parameter is false.
+func (s *Server) handleSequentialTorrent(w http.ResponseWriter, r *http.Request) {
+	on := r.URL.Query().Get("enabled") != "false"
+	s.torrentAction(w, r, func(infoHash string) error {
+		return s.m.SetSequential(infoHash, on)
+	})
+}
+
+// handleRemoveTorrent removes a torrent, and its data if the delete_data
+// query parameter is true.
+func (s *Server) handleRemoveTorrent(w http.ResponseWriter, r *http.Request) {
+	deleteData := r.URL.Query().Get("delete_data") == "true"
+	s.torrentAction(w, r, func(infoHash string) error {
+		return s.m.RemoveTorrent(infoHash, deleteData)
+	})
+}
+
+func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.m.ConfigSnapshot())
+}
+
+// handleSetConfig updates the config with the fields present in the body;
+// missing fields keep their current value.
+func (s *Server) handleSetConfig(w http.ResponseWriter, r *http.Request) {
+	cfg := s.m.ConfigSnapshot()
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.m.UpdateConfig(cfg); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.m.ConfigSnapshot())
+}
+
+func (s *Server) stats() Stats {
+	stats := Stats{
+		States:   make(map[string]int),
+		AltSpeed: s.m.ConfigSnapshot().AltSpeed,
+	}
+	stats.DownloadLimit, stats.UploadLimit = s.m.SpeedLimits()
+
+	s.m.Mu.RLock()
+	for _, item := range s.m.Torrents {
+		stats.Torrents++
+		stats.States[item.State]++
+		stats.DownloadSpeed += bytesPerSecond(item.Speed)
+		stats.UploadSpeed += bytesPerSecond(item.UploadSpeed)
+		stats.Downloaded += item.Downloaded
+		stats.Uploaded += item.Uploaded
+		stats.ActivePeers += item.ActivePeers
+	}
+	s.m.Mu.RUnlock()
+
+	return stats
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.stats())
+}
@@ -0,0 +1,524 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"main/model"
+)
+
+// Torrent status codes of the Transmission RPC protocol.
+const (
+	trStopped      = 0
+	trCheck        = 2
+	trDownloadWait = 3
+	trDownload     = 4
+	trSeedWait     = 5
+	trSeed         = 6
+	trSessionIDKey = "X-Transmission-Session-Id"
+)
+
+// transmissionRequest is the envelope of every Transmission RPC call.
+type transmissionRequest struct {
+	Method    string          `json:"method"`
+	Arguments json.RawMessage `json:"arguments"`
+	Tag       any             `json:"tag,omitempty"`
+}
+
+type transmissionResponse struct {
+	Result    string         `json:"result"`
+	Arguments map[string]any `json:"arguments"`
+	Tag       any            `json:"tag,omitempty"`
+}
+
+func newSessionID() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// handleTransmission serves the Transmission RPC protocol, so existing
+// Transmission remotes and tools can manage RapidTorrent unchanged. Like
+// Transmission, it answers 409 with a session id until the client sends it
+// back, to protect against cross-site requests.
+func (s *Server) handleTransmission(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(trSessionIDKey) != s.sessionID {
+		w.Header().Set(trSessionIDKey, s.sessionID)
+		http.Error(w, "invalid session id", http.StatusConflict)
+		return
+	}
+
+	var req transmissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var args map[string]any
+	var err error
+	switch req.Method {
+	case "torrent-get":
+		args, err = s.trTorrentGet(req.Arguments)
+	case "torrent-add":
+		args, err = s.trTorrentAdd(req.Arguments)
+	case "torrent-start", "torrent-start-now":
+		err = s.trEachTorrent(req.Arguments, s.m.ResumeTorrent)
+	case "torrent-stop":
+		err = s.trEachTorrent(req.Arguments, s.m.PauseTorrent)
+	case "torrent-remove":
+		err = s.trTorrentRemove(req.Arguments)
+	case "queue-move-top":
+		err = s.trQueueMove(req.Arguments, model.QueueTop)
+	case "queue-move-up":
+		err = s.trQueueMove(req.Arguments, model.QueueUp)
+	case "queue-move-down":
+		err = s.trQueueMove(req.Arguments, model.QueueDown)
+	case "queue-move-bottom":
+		err = s.trQueueMove(req.Arguments, model.QueueBottom)
+	case "session-get":
+		args = s.trSession()
+	case "session-set":
+		err = s.trSessionSet(req.Arguments)
+	case "session-stats":
+		args = s.trSessionStats()
+	default:
+		err = fmt.Errorf("method name not recognized")
+	}
+
+	resp := transmissionResponse{Result: "success", Arguments: args, Tag: req.Tag}
+	if err != nil {
+		resp.Result = err.Error()
+	}
+	if resp.Arguments == nil {
+		resp.Arguments = map[string]any{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// trSelect returns the info hashes selected by the "ids" argument, which may
+// be missing (all torrents), a single id, or a list of ids and hash strings.
+// The caller must hold s.m.Mu.
+func (s *Server) trSelect(raw json.RawMessage) []string {
+	var args struct {
+		IDs any `json:"ids"`
+	}
+	json.Unmarshal(raw, &args)
+
+	var ids []any
+	switch v := args.IDs.(type) {
+	case nil:
+		hashes := make([]string, 0, len(s.m.Torrents))
+		for infoHash := range s.m.Torrents {
+			hashes = append(hashes, infoHash)
+		}
+		return hashes
+	case []any:
+		ids = v
+	case string:
+		if v == "recently-active" {
+			return s.trRecentlyActive()
+		}
+		ids = []any{v}
+	default:
+		ids = []any{v}
+	}
+
+	var hashes []string
+	for _, id := range ids {
+		for infoHash, item := range s.m.Torrents {
+			switch v := id.(type) {
+			case float64:
+				if int64(v) == item.ID {
+					hashes = append(hashes, infoHash)
+				}
+			case string:
+				if strings.EqualFold(v, infoHash) {
+					hashes = append(hashes, infoHash)
+				}
+			}
+		}
+	}
+	return hashes
+}
+
+func (s *Server) trRecentlyActive() []string {
+	var hashes []string
+	for infoHash, item := range s.m.Torrents {
+		if item.Speed > 0 || item.UploadSpeed > 0 || time.Since(item.LastUpdate) < time.Minute {
+			hashes = append(hashes, infoHash)
+		}
+	}
+	return hashes
+}
+
+func trStatus(item *model.TorrentItem) int {
+	switch item.State {
+	case "queued":
+		if item.Progress >= 100 {
+			return trSeedWait
+		}
+		return trDownloadWait
+	case "paused", "finished":
+		return trStopped
+	case "verifying":
+		return trCheck
+	case "seeding":
+		return trSeed
+	default:
+		return trDownload
+	}
+}
+
+// trTorrentFields builds every torrent-get field RapidTorrent knows about;
+// the requested ones are picked out by the caller.
+func (s *Server) trTorrentFields(infoHash string, item *model.TorrentItem) map[string]any {
+	t := item.Torrent
+	size := t.Length()
+	left := size - item.Downloaded
+	if left < 0 {
+		left = 0
+	}
+
+	eta := int64(-1)
+	if speed := bytesPerSecond(item.Speed); speed > 0 && left > 0 {
+		eta = left / speed
+	}
+
+	fields := map[string]any{
+		"id":                 item.ID,
+		"hashString":         infoHash,
+		"name":               item.Name,
+		"status":             trStatus(item),
+		"percentDone":        item.Progress / 100,
+		"totalSize":          size,
+		"sizeWhenDone":       size,
+		"leftUntilDone":      left,
+		"haveValid":          item.Downloaded,
+		"rateDownload":       bytesPerSecond(item.Speed),
+		"rateUpload":         bytesPerSecond(item.UploadSpeed),
+		"downloadedEver":     item.Downloaded,
+		"uploadedEver":       item.Uploaded,
+		"uploadRatio":        item.Ratio(),
+		"eta":                eta,
+		"error":              0,
+		"errorString":        "",
+		"downloadDir":        item.SavePath,
+		"isFinished":         item.State == "finished",
+		"isStalled":          item.State == "searching",
+		"peersConnected":     item.ActivePeers,
+		"peersGettingFromUs": 0,
+		"peersSendingToUs":   item.ActivePeers,
+		"secondsSeeding":     int64(item.SeedingTime.Seconds()),
+		"seedRatioLimit":     s.m.ConfigSnapshot().SeedRatio,
+		"seedRatioMode":      0,
+		"magnetLink":         item.MagnetURI,
+		"queuePosition":      item.QueuePosition - 1,
+		"labels":             []string{},
+		"files":              []map[string]any{},
+		"fileStats":          []map[string]any{},
+	}
+
+	if item.Label != "" {
+		fields["labels"] = []string{item.Label}
+	}
+
+	if t.Info() != nil {
+		files := make([]map[string]any, 0, len(t.Files()))
+		fileStats := make([]map[string]any, 0, len(t.Files()))
+		for _, f := range t.Files() {
+			priority := model.FilePriorityName(f.Priority())
+			files = append(files, map[string]any{
+				"name":           f.DisplayPath(),
+				"length":         f.Length(),
+				"bytesCompleted": f.BytesCompleted(),
+			})
+			fileStats = append(fileStats, map[string]any{
+				"bytesCompleted": f.BytesCompleted(),
+				"wanted":         priority != model.FilePrioritySkip,
+				"priority":       map[string]int{model.FilePriorityHigh: 1}[priority],
+			})
+		}
+		fields["files"] = files
+		fields["fileStats"] = fileStats
+	}
+
+	return fields
+}
+
+func (s *Server) trTorrentGet(raw json.RawMessage) (map[string]any, error) {
+	var args struct {
+		Fields []string `json:"fields"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	s.m.Mu.RLock()
+	defer s.m.Mu.RUnlock()
+
+	torrents := []map[string]any{}
+	for _, infoHash := range s.trSelect(raw) {
+		all := s.trTorrentFields(infoHash, s.m.Torrents[infoHash])
+		torrent := make(map[string]any, len(args.Fields))
+		for _, field := range args.Fields {
+			if v, ok := all[field]; ok {
+				torrent[field] = v
+			}
+		}
+		torrents = append(torrents, torrent)
+	}
+	return map[string]any{"torrents": torrents}, nil
+}
+
+// trTorrentAdd adds a torrent from "metainfo" (a base64 encoded .torrent) or
+// "filename", which may be a magnet link, a URL or a local path. The first of
+// its "labels" becomes its label.
+func (s *Server) trTorrentAdd(raw json.RawMessage) (map[string]any, error) {
+	var args struct {
+		Filename    string   `json:"filename"`
+		Metainfo    string   `json:"metainfo"`
+		Paused      bool     `json:"paused"`
+		DownloadDir string   `json:"download-dir"`
+		Labels      []string `json:"labels"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	opts := model.AddOptions{SavePath: args.DownloadDir, Paused: args.Paused}
+	if len(args.Labels) > 0 {
+		opts.Label = args.Labels[0]
+	}
+
+	var infoHash string
+	var existed bool
+	var err error
+	switch {
+	case args.Metainfo != "":
+		data, decodeErr := base64.StdEncoding.DecodeString(args.Metainfo)
+		if decodeErr != nil {
+			return nil, fmt.Errorf("invalid metainfo: %v", decodeErr)
+		}
+		infoHash, existed, err = s.m.AddMetainfoWithOptions(bytes.NewReader(data), opts)
+	case strings.HasPrefix(args.Filename, "magnet:"), strings.Contains(args.Filename, "://"):
+		infoHash, existed, err = s.m.AddURL(args.Filename, opts)
+	case args.Filename != "":
+		f, openErr := os.Open(args.Filename)
+		if openErr != nil {
+			return nil, openErr
+		}
+		defer f.Close()
+		infoHash, existed, err = s.m.AddMetainfoWithOptions(f, opts)
+	default:
+		return nil, fmt.Errorf("no filename or metainfo given")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.m.Mu.RLock()
+	defer s.m.Mu.RUnlock()
+
+	item, exists := s.m.Torrents[infoHash]
+	if !exists {
+		return nil, fmt.Errorf("torrent %s not found", infoHash)
+	}
+	added := map[string]any{"id": item.ID, "name": item.Name, "hashString": infoHash}
+	if existed {
+		return map[string]any{"torrent-duplicate": added}, nil
+	}
+	return map[string]any{"torrent-added": added}, nil
+}
+
+// trEachTorrent runs action on every torrent selected by the "ids" argument.
+func (s *Server) trEachTorrent(raw json.RawMessage, action func(infoHash string) error) error {
+	s.m.Mu.RLock()
+	hashes := s.trSelect(raw)
+	s.m.Mu.RUnlock()
+
+	for _, infoHash := range hashes {
+		if err := action(infoHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) trTorrentRemove(raw json.RawMessage) error {
+	var args struct {
+		DeleteLocalData bool `json:"delete-local-data"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return err
+	}
+	return s.trEachTorrent(raw, func(infoHash string) error {
+		return s.m.RemoveTorrent(infoHash, args.DeleteLocalData)
+	})
+}
+
+func (s *Server) trQueueMove(raw json.RawMessage, direction string) error {
+	return s.trEachTorrent(raw, func(infoHash string) error {
+		return s.m.MoveInQueue(infoHash, direction)
+	})
+}
+
+func (s *Server) trSession() map[string]any {
+	cfg := s.m.ConfigSnapshot()
+	return map[string]any{
+		"version":                  "3.00 (RapidTorrent)",
+		"rpc-version":              17,
+		"rpc-version-minimum":      14,
+		"session-id":               s.sessionID,
+		"download-dir":             cfg.DownloadDir,
+		"incomplete-dir":           cfg.IncompleteDir,
+		"incomplete-dir-enabled":   cfg.IncompleteDir != "",
+		"peer-port":                cfg.ListenPort,
+		"peer-limit-per-torrent":   cfg.MaxConnections,
+		"speed-limit-down":         cfg.DownloadLimit,
+		"speed-limit-down-enabled": cfg.DownloadLimit > 0,
+		"speed-limit-up":           cfg.UploadLimit,
+		"speed-limit-up-enabled":   cfg.UploadLimit > 0,
+		"seedRatioLimit":           cfg.SeedRatio,
+		"seedRatioLimited":         cfg.SeedRatio > 0,
+		"download-queue-enabled":   cfg.MaxActiveDownloads > 0,
+		"download-queue-size":      cfg.MaxActiveDownloads,
+		"seed-queue-enabled":       cfg.MaxActiveSeeds > 0,
+		"seed-queue-size":          cfg.MaxActiveSeeds,
+		"alt-speed-down":           cfg.AltDownloadLimit,
+		"alt-speed-up":             cfg.AltUploadLimit,
+		"alt-speed-enabled":        cfg.AltSpeed,
+		"alt-speed-time-enabled":   cfg.AltSpeedSchedule,
+		"units": map[string]any{
+			"speed-units":  []string{"kB/s", "MB/s", "GB/s", "TB/s"},
+			"speed-bytes":  1024,
+			"size-units":   []string{"KiB", "MiB", "GiB", "TiB"},
+			"size-bytes":   1024,
+			"memory-units": []string{"KiB", "MiB", "GiB", "TiB"},
+			"memory-bytes": 1024,
+		},
+	}
+}
+
+// trSessionSet maps the Transmission session settings RapidTorrent has onto
+// Config. Disabling a speed limit or the seed ratio sets it to 0, disabling the
+// incomplete directory clears it.
+func (s *Server) trSessionSet(raw json.RawMessage) error {
+	var args struct {
+		DownloadDir         *string  `json:"download-dir"`
+		IncompleteDir       *string  `json:"incomplete-dir"`
+		IncompleteDirOn     *bool    `json:"incomplete-dir-enabled"`
+		PeerPort            *int     `json:"peer-port"`
+		PeerLimitPerTorrent *int     `json:"peer-limit-per-torrent"`
+		SpeedLimitDown      *int64   `json:"speed-limit-down"`
+		SpeedLimitDownOn    *bool    `json:"speed-limit-down-enabled"`
+		SpeedLimitUp        *int64   `json:"speed-limit-up"`
+		SpeedLimitUpOn      *bool    `json:"speed-limit-up-enabled"`
+		SeedRatioLimit      *float64 `json:"seedRatioLimit"`
+		SeedRatioLimited    *bool    `json:"seedRatioLimited"`
+		DownloadQueueSize   *int     `json:"download-queue-size"`
+		DownloadQueueOn     *bool    `json:"download-queue-enabled"`
+		SeedQueueSize       *int     `json:"seed-queue-size"`
+		SeedQueueOn         *bool    `json:"seed-queue-enabled"`
+		AltSpeedDown        *int64   `json:"alt-speed-down"`
+		AltSpeedUp          *int64   `json:"alt-speed-up"`
+		AltSpeedOn          *bool    `json:"alt-speed-enabled"`
+		AltSpeedTimeOn      *bool    `json:"alt-speed-time-enabled"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return err
+	}
+
+	cfg := s.m.ConfigSnapshot()
+	if args.DownloadDir != nil {
+		cfg.DownloadDir = *args.DownloadDir
+	}
+	if args.IncompleteDir != nil {
+		cfg.IncompleteDir = *args.IncompleteDir
+	}
+	if args.IncompleteDirOn != nil && !*args.IncompleteDirOn {
+		cfg.IncompleteDir = ""
+	}
+	if args.PeerPort != nil {
+		cfg.ListenPort = *args.PeerPort
+	}
+	if args.PeerLimitPerTorrent != nil {
+		cfg.MaxConnections = *args.PeerLimitPerTorrent
+	}
+	if args.SpeedLimitDown != nil {
+		cfg.DownloadLimit = *args.SpeedLimitDown
+	}
+	if args.SpeedLimitDownOn != nil && !*args.SpeedLimitDownOn {
+		cfg.DownloadLimit = 0
+	}
+	if args.SpeedLimitUp != nil {
+		cfg.UploadLimit = *args.SpeedLimitUp
+	}
+	if args.SpeedLimitUpOn != nil && !*args.SpeedLimitUpOn {
+		cfg.UploadLimit = 0
+	}
+	if args.SeedRatioLimit != nil {
+		cfg.SeedRatio = *args.SeedRatioLimit
+	}
+	if args.SeedRatioLimited != nil && !*args.SeedRatioLimited {
+		cfg.SeedRatio = 0
+	}
+	if args.DownloadQueueSize != nil {
+		cfg.MaxActiveDownloads = *args.DownloadQueueSize
+	}
+	if args.DownloadQueueOn != nil && !*args.DownloadQueueOn {
+		cfg.MaxActiveDownloads = 0
+	}
+	if args.SeedQueueSize != nil {
+		cfg.MaxActiveSeeds = *args.SeedQueueSize
+	}
+	if args.SeedQueueOn != nil && !*args.SeedQueueOn {
+		cfg.MaxActiveSeeds = 0
+	}
+	if args.AltSpeedDown != nil {
+		cfg.AltDownloadLimit = *args.AltSpeedDown
+	}
+	if args.AltSpeedUp != nil {
+		cfg.AltUploadLimit = *args.AltSpeedUp
+	}
+	if args.AltSpeedOn != nil {
+		cfg.AltSpeed = *args.AltSpeedOn
+	}
+	if args.AltSpeedTimeOn != nil {
+		cfg.AltSpeedSchedule = *args.AltSpeedTimeOn
+	}
+
+	return s.m.UpdateConfig(cfg)
+}
+
+func (s *Server) trSessionStats() map[string]any {
+	s.m.Mu.RLock()
+	defer s.m.Mu.RUnlock()
+
+	var active, paused int
+	var down, up int64
+	for _, item := range s.m.Torrents {
+		if trStatus(item) == trStopped {
+			paused++
+		} else {
+			active++
+		}
+		down += bytesPerSecond(item.Speed)
+		up += bytesPerSecond(item.UploadSpeed)
+	}
+
+	return map[string]any{
+		"activeTorrentCount": active,
+		"pausedTorrentCount": paused,
+		"torrentCount":       len(s.m.Torrents),
+		"downloadSpeed":      down,
+		"uploadSpeed":        up,
+	}
+}
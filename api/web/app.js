@@ -0,0 +1,206 @@
+"use strict";
+
+const tbody = document.querySelector("#torrents tbody");
+const empty = document.getElementById("empty");
+const status = document.getElementById("status");
+const message = document.getElementById("message");
+const configForm = document.getElementById("config-form");
+
+// formatBytes matches utils.FormatBytes so sizes read the same as in the
+// terminal UI.
+function formatBytes(bytes) {
+  const unit = 1024;
+  if (bytes < unit) {
+    return bytes + " B";
+  }
+  let div = unit;
+  let exp = 0;
+  for (let n = Math.floor(bytes / unit); n >= unit; n = Math.floor(n / unit)) {
+    div *= unit;
+    exp++;
+  }
+  return (bytes / div).toFixed(1) + " " + "KMGTPE"[exp] + "B";
+}
+
+function showMessage(text, isError) {
+  message.textContent = text;
+  message.classList.toggle("error", !!isError);
+}
+
+async function request(method, path, body) {
+  const opts = { method };
+  if (body instanceof FormData) {
+    opts.body = body;
+  } else if (body !== undefined) {
+    opts.headers = { "Content-Type": "application/json" };
+    opts.body = JSON.stringify(body);
+  }
+
+  const resp = await fetch(path, opts);
+  if (!resp.ok) {
+    let text = resp.statusText;
+    try {
+      text = (await resp.json()).error || text;
+    } catch (e) {
+      // Not a JSON error, keep the status text.
+    }
+    throw new Error(text);
+  }
+  if (resp.status === 204) {
+    return null;
+  }
+  return resp.json();
+}
+
+function button(label, className, onClick) {
+  const b = document.createElement("button");
+  b.textContent = label;
+  b.className = className;
+  b.addEventListener("click", onClick);
+  return b;
+}
+
+function action(method, path, done) {
+  return async () => {
+    try {
+      await request(method, path);
+      showMessage(done);
+    } catch (e) {
+      showMessage(e.message, true);
+    }
+  };
+}
+
+function renderRow(t) {
+  const tr = document.createElement("tr");
+
+  const name = document.createElement("td");
+  name.className = "name";
+  name.textContent = t.name;
+  name.title = t.info_hash;
+  tr.appendChild(name);
+
+  const progress = document.createElement("td");
+  const bar = document.createElement("div");
+  bar.className = "bar";
+  const fill = document.createElement("span");
+  fill.style.width = Math.min(t.progress, 100) + "%";
+  const label = document.createElement("em");
+  label.textContent = t.progress.toFixed(1) + "%";
+  bar.append(fill, label);
+  progress.appendChild(bar);
+  tr.appendChild(progress);
+
+  for (const text of [
+    formatBytes(t.download_speed) + "/s",
+    formatBytes(t.upload_speed) + "/s",
+    t.active_peers + "/" + t.total_peers,
+    t.ratio.toFixed(2),
+    t.state,
+  ]) {
+    const td = document.createElement("td");
+    td.textContent = text;
+    tr.appendChild(td);
+  }
+
+  const actions = document.createElement("td");
+  actions.className = "actions";
+  const base = "/api/torrents/" + t.info_hash;
+  if (t.state === "paused") {
+    actions.appendChild(button("Resume", "secondary", action("POST", base + "/resume", "Resumed " + t.name)));
+  } else {
+    actions.appendChild(button("Pause", "secondary", action("POST", base + "/pause", "Paused " + t.name)));
+  }
+  actions.appendChild(button("Remove", "danger", () => {
+    if (confirm("Remove " + t.name + "?")) {
+      const deleteData = confirm("Also delete the downloaded data?");
+      action("DELETE", base + "?delete_data=" + deleteData, "Removed " + t.name)();
+    }
+  }));
+  tr.appendChild(actions);
+
+  return tr;
+}
+
+function render(update) {
+  tbody.replaceChildren(...update.torrents.map(renderRow));
+  empty.hidden = update.torrents.length > 0;
+
+  const s = update.stats;
+  let text = s.torrents + " torrents";
+  if (s.alt_speed) {
+    text += " • alternate speed limits";
+  }
+  text += " • ↓ " + formatBytes(s.download_speed) + "/s";
+  if (s.download_limit > 0) {
+    text += " (limit " + s.download_limit + " KB/s)";
+  }
+  text += " • ↑ " + formatBytes(s.upload_speed) + "/s";
+  if (s.upload_limit > 0) {
+    text += " (limit " + s.upload_limit + " KB/s)";
+  }
+  status.textContent = text;
+}
+
+function connect() {
+  const events = new EventSource("/api/events");
+  events.onmessage = (e) => render(JSON.parse(e.data));
+  events.onerror = () => {
+    status.textContent = "Disconnected, retrying...";
+  };
+}
+
+document.getElementById("add-magnet").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  const input = e.target.elements.magnet;
+  try {
+    await request("POST", "/api/torrents", { magnet: input.value });
+    input.value = "";
+    showMessage("Torrent added");
+  } catch (err) {
+    showMessage(err.message, true);
+  }
+});
+
+document.getElementById("add-file").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  try {
+    await request("POST", "/api/torrents", new FormData(e.target));
+    e.target.reset();
+    showMessage("Torrent added");
+  } catch (err) {
+    showMessage(err.message, true);
+  }
+});
+
+async function loadConfig() {
+  try {
+    const cfg = await request("GET", "/api/config");
+    for (const [key, value] of Object.entries(cfg)) {
+      const input = configForm.elements[key];
+      if (input) {
+        input.value = value;
+      }
+    }
+  } catch (err) {
+    showMessage(err.message, true);
+  }
+}
+
+configForm.addEventListener("submit", async (e) => {
+  e.preventDefault();
+  const cfg = {};
+  for (const input of configForm.querySelectorAll("input")) {
+    cfg[input.name] = input.type === "number" ? Number(input.value) : input.value;
+  }
+  try {
+    await request("PUT", "/api/config", cfg);
+    showMessage("Configuration applied");
+    loadConfig();
+  } catch (err) {
+    showMessage(err.message, true);
+  }
+});
+
+loadConfig();
+connect();
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"main/api"
+	"main/model"
+	"main/utils"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// socketPath is where every running instance serves its API, so commands can
+// find it. It lives in the state directory, next to the database.
+var socketPath = instancePath("rapidtorrent.sock")
+
+// options are the arguments and flags a subcommand is run with.
+type options struct {
+	args       []string
+	format     string
+	deleteData bool
+
+	// Flags of the create command.
+	output    string
+	pieceSize string
+	add       bool
+	create    model.CreateOptions
+
+	// timeout is how long inspect waits for the metadata of magnet links.
+	timeout time.Duration
+}
+
+type command struct {
+	usage string
+	run   func(c *api.Client, opts options) error
+	// flags, if set, adds the flags only this command takes.
+	flags func(flags *flag.FlagSet, opts *options)
+}
+
+var commands = map[string]command{
+	"add":     {"add <magnet|file>...", runAdd, nil},
+	"list":    {"list", runList, nil},
+	"pause":   {"pause <hash>...", runPause, nil},
+	"resume":  {"resume <hash>...", runResume, nil},
+	"remove":  {"remove [-delete-data] <hash>...", runRemove, nil},
+	"stats":   {"stats", runStats, nil},
+	"inspect": {"inspect [-timeout DURATION] <magnet|file>...", runInspect, inspectFlags},
+	"create":  {"create [-o FILE] [-version v1|v2|hybrid] [-piece-size SIZE] [-tracker URL]... [-webseed URL]... [-comment TEXT] [-source TAG] [-private] [-add] <file|dir>", runCreate, createFlags},
+}
+
+// listFlag is a flag that may be given more than once.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runCommand runs a subcommand against the running instance.
+func runCommand(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q, see rapidtorrent -h", name)
+	}
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: rapidtorrent %s [-format table|json] [-socket PATH]\n", cmd.usage)
+	}
+	var opts options
+	flags.StringVar(&opts.format, "format", "table", "Output format, table or json")
+	socket := flags.String("socket", socketPath, "Socket of the running instance")
+	flags.BoolVar(&opts.deleteData, "delete-data", false, "Also delete downloaded data (remove only)")
+	if cmd.flags != nil {
+		cmd.flags(flags, &opts)
+	}
+	// Flags may come before, between or after the arguments.
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if args = flags.Args(); len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if opts.format != "table" && opts.format != "json" {
+		return fmt.Errorf("unknown format %q", opts.format)
+	}
+
+	opts.args = positional
+	return cmd.run(api.NewClient(*socket), opts)
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func requireArgs(args []string, what string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing %s", what)
+	}
+	return nil
+}
+
+func runAdd(c *api.Client, opts options) error {
+	if err := requireArgs(opts.args, "magnet link or .torrent file"); err != nil {
+		return err
+	}
+
+	var added []map[string]string
+	for _, arg := range opts.args {
+		var infoHash string
+		var err error
+		if strings.HasPrefix(arg, "magnet:") {
+			infoHash, err = c.AddMagnet(arg)
+		} else {
+			infoHash, err = c.AddTorrentFile(arg, "")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %v", arg, err)
+		}
+
+		added = append(added, map[string]string{"source": arg, "info_hash": infoHash})
+		if opts.format == "table" {
+			fmt.Printf("Added %s\n", infoHash)
+		}
+	}
+
+	if opts.format == "json" {
+		return printJSON(added)
+	}
+	return nil
+}
+
+func runList(c *api.Client, opts options) error {
+	torrents, err := c.Torrents()
+	if err != nil {
+		return err
+	}
+	if opts.format == "json" {
+		return printJSON(torrents)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HASH\tNAME\tSTATE\tPROGRESS\tDOWN\tUP\tPEERS\tRATIO")
+	for _, t := range torrents {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.1f%%\t%s/s\t%s/s\t%d/%d\t%.2f\n",
+			t.InfoHash, t.Name, t.State, t.Progress,
+			utils.FormatBytes(t.DownloadSpeed), utils.FormatBytes(t.UploadSpeed),
+			t.ActivePeers, t.TotalPeers, t.Ratio)
+	}
+	return w.Flush()
+}
+
+// eachHash runs action on every hash given, reporting what was done.
+func eachHash(opts options, done string, action func(infoHash string) error) error {
+	if err := requireArgs(opts.args, "info hash"); err != nil {
+		return err
+	}
+
+	var hashes []string
+	for _, infoHash := range opts.args {
+		infoHash = strings.ToLower(infoHash)
+		if err := action(infoHash); err != nil {
+			return err
+		}
+		hashes = append(hashes, infoHash)
+		if opts.format == "table" {
+			fmt.Printf("%s %s\n", done, infoHash)
+		}
+	}
+
+	if opts.format == "json" {
+		return printJSON(map[string]any{"status": strings.ToLower(done), "info_hashes": hashes})
+	}
+	return nil
+}
+
+func runPause(c *api.Client, opts options) error {
+	return eachHash(opts, "Paused", c.Pause)
+}
+
+func runResume(c *api.Client, opts options) error {
+	return eachHash(opts, "Resumed", c.Resume)
+}
+
+func runRemove(c *api.Client, opts options) error {
+	return eachHash(opts, "Removed", func(infoHash string) error {
+		return c.Remove(infoHash, opts.deleteData)
+	})
+}
+
+func runStats(c *api.Client, opts options) error {
+	stats, err := c.Stats()
+	if err != nil {
+		return err
+	}
+	if opts.format == "json" {
+		return printJSON(stats)
+	}
+
+	limit := func(kbps int64) string {
+		if kbps <= 0 {
+			return "unlimited"
+		}
+		return fmt.Sprintf("%d KB/s", kbps)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Torrents:\t%d\n", stats.Torrents)
+	states := make([]string, 0, len(stats.States))
+	for state := range stats.States {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	for _, state := range states {
+		fmt.Fprintf(w, "  %s:\t%d\n", state, stats.States[state])
+	}
+	if stats.AltSpeed {
+		fmt.Fprintf(w, "Speed limits:\talternate\n")
+	}
+	fmt.Fprintf(w, "Download speed:\t%s/s (limit %s)\n", utils.FormatBytes(stats.DownloadSpeed), limit(stats.DownloadLimit))
+	fmt.Fprintf(w, "Upload speed:\t%s/s (limit %s)\n", utils.FormatBytes(stats.UploadSpeed), limit(stats.UploadLimit))
+	fmt.Fprintf(w, "Downloaded:\t%s\n", utils.FormatBytes(stats.Downloaded))
+	fmt.Fprintf(w, "Uploaded:\t%s\n", utils.FormatBytes(stats.Uploaded))
+	fmt.Fprintf(w, "Active peers:\t%d\n", stats.ActivePeers)
+	return w.Flush()
+}
+
+func createFlags(flags *flag.FlagSet, opts *options) {
+	flags.StringVar(&opts.output, "o", "", "File to write the torrent to (default NAME.torrent)")
+	flags.StringVar(&opts.create.Version, "version", model.TorrentV1, "Torrent version, v1, v2 or hybrid")
+	flags.StringVar(&opts.pieceSize, "piece-size", "auto", "Piece size, e.g. 256K or 4M")
+	flags.Var((*listFlag)(&opts.create.Trackers), "tracker", "Tracker announce URL, may be repeated")
+	flags.Var((*listFlag)(&opts.create.WebSeeds), "webseed", "Web seed URL, may be repeated")
+	flags.StringVar(&opts.create.Comment, "comment", "", "Comment")
+	flags.StringVar(&opts.create.Source, "source", "", "Source tag, as some private trackers require")
+	flags.BoolVar(&opts.create.Private, "private", false, "Mark the torrent private, disabling DHT and PEX")
+	flags.BoolVar(&opts.add, "add", false, "Add the torrent to the running instance, seeding from the data")
+}
+
+// runCreate hashes a file or directory into a new .torrent file. It runs
+// locally; only -add needs the running instance.
+func runCreate(c *api.Client, opts options) error {
+	if len(opts.args) != 1 {
+		return fmt.Errorf("expected one file or directory")
+	}
+	root, err := filepath.Abs(opts.args[0])
+	if err != nil {
+		return err
+	}
+
+	output := opts.output
+	if output == "" {
+		output = filepath.Base(root) + ".torrent"
+	}
+	// Hashing may take long, so find out first if the result can be saved.
+	if _, err := os.Stat(output); err == nil {
+		return fmt.Errorf("%s already exists", output)
+	}
+
+	create := opts.create
+	if create.PieceLength, err = model.ParsePieceLength(opts.pieceSize); err != nil {
+		return err
+	}
+	last := -1
+	if opts.format == "table" {
+		create.Progress = func(hashed, total int64) {
+			if percent := int(hashed * 100 / total); percent != last {
+				last = percent
+				fmt.Fprintf(os.Stderr, "\rHashing %s: %d%%", filepath.Base(root), percent)
+			}
+		}
+	}
+
+	mi, err := model.CreateTorrent(root, create)
+	if last >= 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return err
+	}
+	infoHash, err := model.TorrentInfoHash(mi)
+	if err != nil {
+		return err
+	}
+
+	if err := model.WriteTorrentFile(output, mi); err != nil {
+		return err
+	}
+	if opts.format == "table" {
+		fmt.Printf("Created %s (%s)\n", output, infoHash)
+	}
+
+	if opts.add {
+		// The data is where it was hashed, so the torrent starts as a seed.
+		if infoHash, err = c.AddTorrentFile(output, filepath.Dir(root)); err != nil {
+			return fmt.Errorf("failed to add %s: %v", output, err)
+		}
+		if opts.format == "table" {
+			fmt.Printf("Added %s, seeding from %s\n", infoHash, filepath.Dir(root))
+		}
+	}
+
+	if opts.format == "json" {
+		return printJSON(map[string]any{"file": output, "info_hash": infoHash, "added": opts.add})
+	}
+	return nil
+}
+
+func inspectFlags(flags *flag.FlagSet, opts *options) {
+	flags.DurationVar(&opts.timeout, "timeout", time.Minute, "How long to wait for the metadata of magnet links")
+}
+
+// runInspect shows what torrents hold without adding them. It runs locally,
+// fetching only the metadata of magnet links from peers.
+func runInspect(c *api.Client, opts options) error {
+	if err := requireArgs(opts.args, "magnet link or .torrent file"); err != nil {
+		return err
+	}
+
+	summaries := []model.TorrentSummary{}
+	for i, arg := range opts.args {
+		var mi *metainfo.MetaInfo
+		var err error
+		if strings.HasPrefix(arg, "magnet:") {
+			if opts.format == "table" {
+				fmt.Fprintln(os.Stderr, "Fetching metadata...")
+			}
+			mi, err = model.FetchMetainfo(arg, opts.timeout)
+		} else {
+			mi, err = model.LoadMetainfo(arg)
+		}
+		if err != nil {
+			return err
+		}
+
+		summary, err := model.Summarize(mi)
+		if err != nil {
+			return fmt.Errorf("%s: %v", arg, err)
+		}
+		summaries = append(summaries, summary)
+		if opts.format == "table" {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Print(summary.Text())
+		}
+	}
+
+	if opts.format == "json" {
+		return printJSON(summaries)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"main/model"
+)
+
+// runDaemon runs the torrent engine without a terminal UI until SIGINT or
+// SIGTERM is received. State changes and errors are logged to logPath, or
+// to stdout if it is empty.
+func runDaemon(m *model.Model, logPath string) error {
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+	if logPath != "" {
+		f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		logger.SetOutput(f)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	ticker := time.NewTicker(time.Second / 2)
+	defer ticker.Stop()
+
+	logger.Print("RapidTorrent daemon started")
+
+	states := make(map[string]string)
+	var lastErr error
+	for {
+		select {
+		case sig := <-sigs:
+			logger.Printf("Received %v, shutting down", sig)
+			return nil
+		case <-ticker.C:
+			m.UpdateTorrents()
+			lastErr = logChanges(logger, m, states, lastErr)
+		}
+	}
+}
+
+// logChanges logs torrents that were added, removed or changed state since
+// the last call, and the current error if it is a new one.
+func logChanges(logger *log.Logger, m *model.Model, states map[string]string, lastErr error) error {
+	m.Mu.RLock()
+	defer m.Mu.RUnlock()
+
+	for infoHash, item := range m.Torrents {
+		state, known := states[infoHash]
+		if !known {
+			logger.Printf("Added %s (%s)", infoHash, item.Name)
+		} else if state != item.State {
+			logger.Printf("%s (%s): %s -> %s", infoHash, item.Name, state, item.State)
+		}
+		states[infoHash] = item.State
+	}
+	for infoHash := range states {
+		if _, exists := m.Torrents[infoHash]; !exists {
+			logger.Printf("Removed %s", infoHash)
+			delete(states, infoHash)
+		}
+	}
+
+	if m.Err != nil && m.Err != lastErr {
+		logger.Printf("Error: %v", m.Err)
+	}
+	return m.Err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"main/api"
+	"main/model"
+)
+
+// lockPath is held by the running instance for as long as it runs. Like the
+// control socket, it is kept per user, so an instance started from any
+// directory, e.g. by the desktop for a magnet: link, finds the running one.
+var lockPath = instancePath("rapidtorrent.lock")
+
+// forwardTimeout is how long a second invocation waits for the running
+// instance to serve its control socket, which it does only after restoring
+// its torrents.
+const forwardTimeout = 15 * time.Second
+
+var errLocked = errors.New("another instance is running")
+
+// instancePath returns the path of a file the running instance is found by,
+// in the state directory, or in the working directory if there is none.
+func instancePath(name string) string {
+	dir, err := model.StateDir()
+	if err != nil {
+		return "./" + name
+	}
+	return filepath.Join(dir, name)
+}
+
+// instanceLock keeps other instances from using the same database.
+type instanceLock struct {
+	f *os.File
+}
+
+func acquireLock() (*instanceLock, error) {
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	f.Truncate(0)
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	return &instanceLock{f: f}, nil
+}
+
+// release unlocks the lock file. The file itself stays, removing it would
+// let a starting instance lock a file that is about to be deleted.
+func (l *instanceLock) release() {
+	l.f.Close()
+}
+
+// isTorrentArg reports whether a bare argument is a magnet link or .torrent
+// file, as passed by the desktop when RapidTorrent handles magnet: links.
+func isTorrentArg(arg string) bool {
+	return strings.HasPrefix(arg, "magnet:") || strings.HasSuffix(strings.ToLower(arg), ".torrent")
+}
+
+// forward hands the torrents given on the command line to the running
+// instance.
+func forward(magnetURL, torrentFile string) error {
+	c := api.NewClient(socketPath)
+
+	deadline := time.Now().Add(forwardTimeout)
+	for {
+		_, err := c.Stats()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	if magnetURL != "" {
+		infoHash, err := c.AddMagnet(magnetURL)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added %s to the running instance\n", infoHash)
+	}
+	if torrentFile != "" {
+		infoHash, err := c.AddTorrentFile(torrentFile, "")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added %s to the running instance\n", infoHash)
+	}
+	if magnetURL == "" && torrentFile == "" {
+		fmt.Println("RapidTorrent is already running")
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+
+	"main/api"
+)
+
+// lockFile falls back to asking the control socket whether an instance is
+// running, where file locks aren't available.
+func lockFile(f *os.File) error {
+	if _, err := api.NewClient(socketPath).Stats(); err == nil {
+		return errLocked
+	}
+	return nil
+}
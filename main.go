@@ -3,8 +3,12 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
+	"os"
+	"strings"
 	"time"
 
+	"main/api"
 	"main/model"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -15,34 +19,115 @@ func printUsage() {
 RapidTorrent - A simple terminal torrent client
 
 Usage:
-    rapidtorrent [options]
+    rapidtorrent [options] [magnet link or .torrent file]
+    rapidtorrent <command> [-format table|json] [-socket PATH] [arguments]
+
+Only one instance runs per user. Starting another one passes its
+magnet link or .torrent file to the running instance instead, so
+"rapidtorrent %%u" can be registered as the handler for magnet: links.
+
+Commands (sent to the running instance):
+    add <magnet|file>...                 Add torrents
+    list                                 List torrents
+    pause <hash>...                      Pause torrents
+    resume <hash>...                     Resume torrents
+    remove [-delete-data] <hash>...      Remove torrents, optionally with data
+    stats                                Show transfer statistics
+    inspect [-timeout D] <magnet|file>   Show what torrents hold, run locally
+    create [flags] <file|dir>            Create a .torrent file, run locally:
+        -o FILE                          File to write (default NAME.torrent)
+        -version v1|v2|hybrid            Torrent version (default v1)
+        -piece-size SIZE                 Piece size, e.g. 256K (default auto)
+        -tracker URL, -webseed URL       Trackers and web seeds, repeatable
+        -comment TEXT, -source TAG       Comment and source tag
+        -private                         Mark the torrent private
+        -add                             Seed it in the running instance
 
 Options:
     -h, --help      Show this help message
     -magnet URL     Download torrent from magnet URL
     -file PATH      Download torrent from .torrent file
+                    (the terminal UI opens the add dialog for these first)
+    -daemon         Run without the terminal UI, e.g. as a service
+    -log PATH       Log file for daemon mode (default stdout)
+    -api ADDR       Serve the JSON control API and the web UI on a loopback
+                    host:port or on a Unix socket given as unix:/path/to/socket;
+                    Transmission clients can connect to /transmission/rpc
+                    and qBittorrent clients to /api/v2. Other addresses need
+                    a web password or API token, set on the config screen.
+                    Files are streamed from /stream/HASH/INDEX, and
+                    /stream/HASH is a playlist of all files of a torrent
 
 Examples:
     rapidtorrent
     rapidtorrent -magnet "magnet:?xt=urn:btih:..."
     rapidtorrent -file "path/to/file.torrent"
+    rapidtorrent -daemon -log /var/log/rapidtorrent.log
+    rapidtorrent -daemon -api 127.0.0.1:9090
+    rapidtorrent list -format json
+    rapidtorrent create -tracker udp://tracker.example:1337 -add ~/Videos/clip.mkv
 
 Keys:
-    enter   Add new magnet link
+    enter   Add new magnet link in the add dialog, where the destination,
+            label, files and start options are chosen, or show details
+            of selected torrent
+    up/down Select torrent
+    p       Pause selected torrent
+    r       Resume selected torrent
+    d       Remove selected torrent
+    D       Remove selected torrent and its data
+    f       Choose files of selected torrent
+    s       Toggle sequential download of selected torrent
+    K/J     Move selected torrent up/down in the queue
+    T       Move selected torrent to the top of the queue
+    R       Manage RSS/Atom feeds
+    n       Create a torrent from a file or directory
+    i       Inspect a magnet link or .torrent file before adding it
+    A       Toggle alternate speed limits
+    S       Edit alternate speed schedule
+    tab     Switch between detail tabs
 		esc     Back
     q       Quit application
     ctrl+c  Force quit
 `)
 }
 
+// startAPI serves the control API on addr in the background.
+func startAPI(m *model.Model, addr string) (*http.Server, error) {
+	l, err := api.Listen(addr, m.ConfigSnapshot())
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &http.Server{Handler: api.NewServer(m, l)}
+	go srv.Serve(l)
+	return srv, nil
+}
+
 func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") && !isTorrentArg(os.Args[1]) {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			if err != flag.ErrHelp {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
 	var magnetURL string
 	var torrentFile string
 	var help bool
+	var daemon bool
+	var logPath string
+	var apiAddr string
 
 	flag.BoolVar(&help, "h", false, "Show help message")
 	flag.StringVar(&magnetURL, "magnet", "", "Magnet URL to start downloading")
 	flag.StringVar(&torrentFile, "file", "", "Path to .torrent file to start downloading")
+	flag.BoolVar(&daemon, "daemon", false, "Run without the terminal UI")
+	flag.StringVar(&logPath, "log", "", "Log file for daemon mode")
+	flag.StringVar(&apiAddr, "api", "", "Address to serve the control API on")
 	flag.Parse()
 
 	// Show help if -h flag is provided
@@ -51,6 +136,26 @@ func main() {
 		return
 	}
 
+	// A bare magnet link or .torrent file, as passed by a desktop handler.
+	if arg := flag.Arg(0); strings.HasPrefix(arg, "magnet:") {
+		magnetURL = arg
+	} else if isTorrentArg(arg) {
+		torrentFile = arg
+	}
+
+	lock, err := acquireLock()
+	if err == errLocked {
+		if err := forward(magnetURL, torrentFile); err != nil {
+			fmt.Printf("Error forwarding to the running instance: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	} else if err != nil {
+		fmt.Printf("Error locking %s: %v\n", lockPath, err)
+		return
+	}
+	defer lock.release()
+
 	m, err := model.InitialModel()
 	if err != nil {
 		fmt.Printf("Error initializing: %v\n", err)
@@ -58,19 +163,41 @@ func main() {
 	}
 
 	defer func() {
-		_, err := m.DB.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
-		if err != nil {
-			fmt.Printf("Error checkpointing WAL: %v\n", err)
+		if err := m.Close(); err != nil {
+			fmt.Printf("%v\n", err)
 		}
-		m.DB.Close()
 	}()
 
-	// Handle command line arguments
-	if magnetURL != "" {
-		go m.AddTorrent(magnetURL)
+	// The control socket is always served, for the subcommands.
+	sock, err := startAPI(m, "unix:"+socketPath)
+	if err != nil {
+		fmt.Printf("Error starting control socket: %v\n", err)
+		return
 	}
-	if torrentFile != "" {
-		go m.AddTorrentFromFile(torrentFile)
+	defer sock.Close()
+
+	if apiAddr != "" {
+		srv, err := startAPI(m, apiAddr)
+		if err != nil {
+			fmt.Printf("Error starting API: %v\n", err)
+			return
+		}
+		defer srv.Close()
+		m.StreamURL = api.BaseURL(apiAddr, m.ConfigSnapshot())
+	}
+
+	if daemon {
+		// Handle command line arguments
+		if magnetURL != "" {
+			go m.AddTorrent(magnetURL)
+		}
+		if torrentFile != "" {
+			go m.AddTorrentFromFile(torrentFile)
+		}
+		if err := runDaemon(m, logPath); err != nil {
+			fmt.Printf("Error running daemon: %v\n", err)
+		}
+		return
 	}
 
 	go func() {
@@ -80,6 +207,18 @@ func main() {
 		}
 	}()
 
+	// The terminal UI asks how to add a torrent passed on the command line.
+	// There is one dialog, so a magnet link given along with a file is added
+	// right away.
+	if torrentFile != "" {
+		m.OpenAdd(torrentFile)
+		if magnetURL != "" {
+			go m.AddTorrent(magnetURL)
+		}
+	} else if magnetURL != "" {
+		m.OpenAdd(magnetURL)
+	}
+
 	p := tea.NewProgram(m, tea.WithAltScreen())
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Error running program: %v\n", err)
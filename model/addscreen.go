@@ -0,0 +1,308 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"main/utils"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Inputs of the add torrent dialog, in the order they are shown. The file
+// list comes after them.
+const (
+	addInputSavePath = iota
+	addInputLabel
+	addInputPaused
+	addInputSequential
+	addInputSkipCheck
+)
+
+// addFile is a file of the torrent in the add dialog.
+type addFile struct {
+	// index is the index of the file in the torrent, counting pad files.
+	index int
+	path  string
+	size  int64
+	skip  bool
+}
+
+// addLoadedMsg carries the metainfo of the torrent in the add dialog.
+type addLoadedMsg struct {
+	source string
+	mi     *metainfo.MetaInfo
+	err    error
+}
+
+// torrentAddedMsg is sent when the torrent of the add dialog was added.
+type torrentAddedMsg struct {
+	name     string
+	infoHash string
+	existed  bool
+	err      error
+}
+
+// OpenAdd shows the add dialog for a magnet link or .torrent file. Its
+// metadata is loaded by the command of loadAdd, which Init runs for a dialog
+// opened before the program starts.
+func (m *Model) OpenAdd(source string) {
+	m.ShowAdd = true
+	m.AddSource = source
+	m.AddLoading = true
+	m.AddSummary = nil
+	m.AddInputs = nil
+	m.AddFocus = 0
+	m.addFiles = nil
+	m.addFileCursor = 0
+	m.addMetainfo = nil
+}
+
+// loadAdd loads the metainfo of the torrent in the add dialog in the
+// background. Magnet links wait for peers to send it.
+func (m *Model) loadAdd() tea.Cmd {
+	source := m.AddSource
+	return func() tea.Msg {
+		var mi *metainfo.MetaInfo
+		var err error
+		if strings.HasPrefix(source, "magnet:") {
+			mi, err = m.FetchMetainfo(source)
+		} else {
+			mi, err = LoadMetainfo(source)
+		}
+		return addLoadedMsg{source: source, mi: mi, err: err}
+	}
+}
+
+func (m *Model) handleAddLoaded(msg addLoadedMsg) {
+	if !m.ShowAdd || !m.AddLoading || msg.source != m.AddSource {
+		return
+	}
+	m.AddLoading = false
+	if msg.err == nil {
+		msg.err = m.setAddMetainfo(msg.mi)
+	}
+	if msg.err != nil {
+		m.ShowAdd = false
+		m.Err = msg.err
+		return
+	}
+	m.Err = nil
+}
+
+// setAddMetainfo fills the add dialog in with the torrent of mi.
+func (m *Model) setAddMetainfo(mi *metainfo.MetaInfo) error {
+	summary, err := Summarize(mi)
+	if err != nil {
+		return err
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return fmt.Errorf("invalid metainfo: %v", err)
+	}
+
+	m.addMetainfo = mi
+	m.AddSummary = &summary
+	m.addFiles = nil
+	for i, fi := range info.UpvertedFiles() {
+		if strings.Contains(fi.Attr, "p") {
+			continue
+		}
+		m.addFiles = append(m.addFiles, addFile{index: i, path: fi.DisplayPath(&info), size: fi.Length})
+	}
+
+	m.AddInputs = []textinput.Model{
+		newConfigInput("Destination", "Empty for the label or default directory", ""),
+		newConfigInput("Label", "Enter label", ""),
+		newConfigInput("Start Paused (on/off)", "Enter on or off", "off"),
+		newConfigInput("Sequential (on/off)", "Enter on or off", "off"),
+		newConfigInput("Skip Hash Check (on/off)", "Enter on or off", "off"),
+	}
+	m.AddFocus = addInputSavePath
+	m.AddInputs[m.AddFocus].Focus()
+	return nil
+}
+
+// commitAdd adds the torrent of the add dialog as chosen in it.
+func (m *Model) commitAdd() tea.Cmd {
+	value := func(i int) string {
+		return strings.TrimSpace(m.AddInputs[i].Value())
+	}
+
+	opts := AddOptions{
+		SavePath:      value(addInputSavePath),
+		Label:         value(addInputLabel),
+		Paused:        isOn(value(addInputPaused)),
+		Sequential:    isOn(value(addInputSequential)),
+		SkipHashCheck: isOn(value(addInputSkipCheck)),
+	}
+	if opts.SavePath != "" {
+		savePath, err := filepath.Abs(opts.SavePath)
+		if err != nil {
+			m.Err = err
+			return nil
+		}
+		opts.SavePath = savePath
+	}
+	for _, f := range m.addFiles {
+		if f.skip {
+			opts.SkipFiles = append(opts.SkipFiles, f.index)
+		}
+	}
+	if len(opts.SkipFiles) == len(m.addFiles) {
+		m.Err = fmt.Errorf("select at least one file to download")
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := m.addMetainfo.Write(&buf); err != nil {
+		m.Err = err
+		return nil
+	}
+	name := m.AddSummary.Name
+
+	m.Err = nil
+	m.ShowAdd = false
+	return func() tea.Msg {
+		infoHash, existed, err := m.AddMetainfoWithOptions(&buf, opts)
+		return torrentAddedMsg{name: name, infoHash: infoHash, existed: existed, err: err}
+	}
+}
+
+func (m *Model) handleAdded(msg torrentAddedMsg) {
+	if msg.err != nil {
+		m.Err = msg.err
+		return
+	}
+	if msg.existed {
+		m.Notice = fmt.Sprintf("%s is already added, its options were left as they are", msg.name)
+		return
+	}
+	m.Notice = fmt.Sprintf("Added %s", msg.name)
+}
+
+func (m *Model) updateAdd(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		// Leaving while metadata is fetched drops the result.
+		m.ShowAdd = false
+		m.AddLoading = false
+		m.Err = nil
+		return m, nil
+	}
+	if m.AddLoading {
+		return m, nil
+	}
+
+	onFiles := m.AddFocus == len(m.AddInputs)
+	switch msg.String() {
+	case "enter":
+		return m, m.commitAdd()
+	case "tab", "shift+tab":
+		if !onFiles {
+			m.AddInputs[m.AddFocus].Blur()
+		}
+		if msg.String() == "tab" {
+			m.AddFocus = (m.AddFocus + 1) % (len(m.AddInputs) + 1)
+		} else {
+			m.AddFocus = (m.AddFocus + len(m.AddInputs)) % (len(m.AddInputs) + 1)
+		}
+		if m.AddFocus < len(m.AddInputs) {
+			m.AddInputs[m.AddFocus].Focus()
+		}
+		return m, nil
+	}
+
+	if onFiles {
+		switch msg.String() {
+		case "up":
+			if m.addFileCursor > 0 {
+				m.addFileCursor--
+			}
+		case "down":
+			if m.addFileCursor < len(m.addFiles)-1 {
+				m.addFileCursor++
+			}
+		case " ":
+			m.addFiles[m.addFileCursor].skip = !m.addFiles[m.addFileCursor].skip
+		case "a":
+			// Selects every file, or none if all are selected already.
+			skip := true
+			for _, f := range m.addFiles {
+				if f.skip {
+					skip = false
+					break
+				}
+			}
+			for i := range m.addFiles {
+				m.addFiles[i].skip = skip
+			}
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.AddInputs[m.AddFocus], cmd = m.AddInputs[m.AddFocus].Update(msg)
+	return m, cmd
+}
+
+func (m *Model) addView() string {
+	var s strings.Builder
+
+	if m.AddLoading {
+		s.WriteString(titleStyle.Render("Add Torrent"))
+		s.WriteString("\n\n")
+		s.WriteString(m.AddSource)
+		s.WriteString("\n\nFetching metadata... Esc to cancel")
+		return s.String()
+	}
+
+	summary := m.AddSummary
+	s.WriteString(titleStyle.Render("Add Torrent: " + summary.Name))
+	s.WriteString("\n\n")
+	var selected int64
+	for _, f := range m.addFiles {
+		if !f.skip {
+			selected += f.size
+		}
+	}
+	s.WriteString(fmt.Sprintf("Size: %s of %s selected • %d files\n\n", utils.FormatBytes(selected), utils.FormatBytes(summary.TotalSize), len(m.addFiles)))
+
+	for _, input := range m.AddInputs {
+		s.WriteString(input.View())
+		s.WriteString("\n")
+	}
+
+	s.WriteString("\nFiles:\n")
+	onFiles := m.AddFocus == len(m.AddInputs)
+	// Only the files around the cursor are shown when they don't fit.
+	rows := max(m.Height-len(m.AddInputs)-14, 3)
+	first := max(min(m.addFileCursor-rows/2, len(m.addFiles)-rows), 0)
+	for i := first; i < len(m.addFiles) && i < first+rows; i++ {
+		f := m.addFiles[i]
+		check := "[x]"
+		if f.skip {
+			check = "[ ]"
+		}
+		line := fmt.Sprintf("%s %10s  %s", check, utils.FormatBytes(f.size), f.path)
+		if onFiles && i == m.addFileCursor {
+			s.WriteString(selectedStyle.Render("> " + line))
+		} else {
+			s.WriteString("  " + line)
+		}
+		s.WriteString("\n")
+	}
+
+	if onFiles {
+		s.WriteString("\n↑/↓ select • Space toggle file • 'a' toggle all • Enter to add • Tab to switch fields • Esc to cancel")
+	} else {
+		s.WriteString("\nPress Enter to add, Tab to switch fields and the file list, Esc to cancel")
+	}
+	return s.String()
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Values typed into a secret field of the config screen: an empty field keeps
+// the current secret, removeSecret clears it and, for the API token,
+// generateSecret creates a random one.
+const (
+	removeSecret   = "-"
+	generateSecret = "new"
+)
+
+// AuthEnabled reports whether remote interfaces require credentials, which
+// is the case once a password or an API token is set.
+func (c Config) AuthEnabled() bool {
+	return c.AuthPassword != "" || c.APIToken != ""
+}
+
+// CheckPassword reports whether username and password match the configured
+// credentials.
+func (c Config) CheckPassword(username, password string) bool {
+	if c.AuthPassword == "" {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(c.AuthUsername)) == 1
+	passOK := bcrypt.CompareHashAndPassword([]byte(c.AuthPassword), []byte(password)) == nil
+	return userOK && passOK
+}
+
+// CheckToken reports whether token is the configured API token.
+func (c Config) CheckToken(token string) bool {
+	if c.APIToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(c.APIToken)) == 1
+}
+
+// StreamToken returns the token that lets media players, which can't log in,
+// stream the files of a torrent. It is derived from the stored credentials,
+// so it stays the same across restarts and changes along with them.
+func (c Config) StreamToken(infoHash string) string {
+	mac := hmac.New(sha256.New, []byte(c.AuthPassword+"\x00"+c.APIToken))
+	mac.Write([]byte(strings.ToLower(infoHash)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckStreamToken reports whether token is the stream token of a torrent.
+func (c Config) CheckStreamToken(infoHash, token string) bool {
+	if !c.AuthEnabled() {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(c.StreamToken(infoHash)))
+}
+
+// StreamFileURL returns the URL a file of a torrent is streamed from, with
+// its stream token if credentials are required, or "" if nothing is served.
+func (m *Model) StreamFileURL(infoHash string, index int) string {
+	if m.StreamURL == "" {
+		return ""
+	}
+	u := fmt.Sprintf("%s/stream/%s/%d", m.StreamURL, infoHash, index)
+	if cfg := m.ConfigSnapshot(); cfg.AuthEnabled() {
+		u += "?token=" + cfg.StreamToken(infoHash)
+	}
+	return u
+}
+
+// hashToken returns the form an API token is stored in. Tokens are long and
+// random, so a plain SHA-256 is enough and keeps checking them cheap.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// updatePassword returns the stored password for the value typed on the
+// config screen.
+func updatePassword(current, value string) (string, error) {
+	switch value {
+	case "":
+		return current, nil
+	case removeSecret:
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(value), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// updateToken returns the stored API token for the value typed on the config
+// screen, along with the token itself if a new one was generated.
+func updateToken(current, value string) (stored, generated string) {
+	switch value {
+	case "":
+		return current, ""
+	case removeSecret:
+		return "", ""
+	case generateSecret:
+		generated = newToken()
+		return hashToken(generated), generated
+	}
+	return hashToken(value), ""
+}
+
+// isOn parses a yes/no value typed on the config screen.
+func isOn(value string) bool {
+	switch value {
+	case "on", "yes", "true", "1":
+		return true
+	}
+	return false
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
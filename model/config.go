@@ -2,13 +2,86 @@ package model
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
-	"sync"
-	"time"
 
 	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"golang.org/x/time/rate"
 )
 
+const (
+	// Burst sizes for the rate limiters. The upload burst must fit at least
+	// one 16 KiB chunk, otherwise the client can never serve a request.
+	downloadBurst = 1 << 16
+	uploadBurst   = 256 << 10
+)
+
+// newRateLimiter creates a limiter for a KB/s value, where 0 means unlimited.
+func newRateLimiter(kbps int64, burst int) *rate.Limiter {
+	l := rate.NewLimiter(rate.Inf, 0)
+	setRateLimit(l, kbps, burst)
+	return l
+}
+
+func setRateLimit(l *rate.Limiter, kbps int64, burst int) {
+	if kbps <= 0 {
+		l.SetLimit(rate.Inf)
+		l.SetBurst(0)
+		return
+	}
+	l.SetLimit(rate.Limit(kbps * 1024))
+	l.SetBurst(burst)
+}
+
+// applyRateLimits updates the limiters shared with the torrent client, so
+// new limits take effect immediately.
+func (m *Model) applyRateLimits() {
+	download, upload := m.SpeedLimits()
+	setRateLimit(m.DownloadLimiter, download, downloadBurst)
+	setRateLimit(m.UploadLimiter, upload, uploadBurst)
+}
+
+// dataDir returns the directory torrent data is stored in.
+func (m *Model) dataDir() string {
+	if dir := m.ConfigSnapshot().DownloadDir; dir != "" {
+		return dir
+	}
+	return filepath.Join(homeDir, "Downloads")
+}
+
+func (m *Model) maxConnections() int {
+	if n := m.ConfigSnapshot().MaxConnections; n > 0 {
+		return n
+	}
+	return 50
+}
+
+func (m *Model) newClientConfig() *torrent.ClientConfig {
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = m.dataDir()
+	cfg.DefaultStorage = m.storageFor(m.dataDir())
+	cfg.EstablishedConnsPerTorrent = m.maxConnections()
+	if port := m.ConfigSnapshot().ListenPort; port > 0 {
+		cfg.ListenPort = port
+	}
+	cfg.MaxUnverifiedBytes = 1 << 30
+	cfg.DisableIPv6 = false
+	cfg.DisableTCP = false
+	cfg.DisableUTP = false
+	cfg.NoDHT = false
+	cfg.NoUpload = false
+	cfg.Seed = true
+	cfg.DownloadRateLimiter = m.DownloadLimiter
+	cfg.UploadRateLimiter = m.UploadLimiter
+	cfg.Callbacks.ReadMessage = m.peerUploads.readMessage
+	cfg.Callbacks.PeerConnClosed = m.peerUploads.closed
+	return cfg
+}
+
 func (m *Model) LoadConfig() error {
 	rows, err := m.DB.Query("SELECT key, value FROM config")
 	if err != nil {
@@ -30,6 +103,26 @@ func (m *Model) LoadConfig() error {
 	m.Config.SeedRatio, _ = strconv.ParseFloat(config["seed_ratio"], 64)
 	m.Config.DownloadLimit, _ = strconv.ParseInt(config["download_limit"], 10, 64)
 	m.Config.UploadLimit, _ = strconv.ParseInt(config["upload_limit"], 10, 64)
+	m.Config.SeedTime, _ = strconv.Atoi(config["seed_time"])
+	m.Config.ListenPort, _ = strconv.Atoi(config["listen_port"])
+	m.Config.AuthUsername = config["auth_username"]
+	m.Config.AuthPassword = config["auth_password"]
+	m.Config.APIToken = config["api_token"]
+	m.Config.TLS, _ = strconv.ParseBool(config["tls"])
+	m.Config.TLSCert = config["tls_cert"]
+	m.Config.TLSKey = config["tls_key"]
+	m.Config.LoginAttempts, _ = strconv.Atoi(config["login_attempts"])
+	m.Config.WatchDirs = parseWatchDirs(config["watch_dirs"])
+	m.Config.FeedInterval, _ = strconv.Atoi(config["feed_interval"])
+	m.Config.MaxActiveDownloads, _ = strconv.Atoi(config["max_active_downloads"])
+	m.Config.MaxActiveSeeds, _ = strconv.Atoi(config["max_active_seeds"])
+	m.Config.AltDownloadLimit, _ = strconv.ParseInt(config["alt_download_limit"], 10, 64)
+	m.Config.AltUploadLimit, _ = strconv.ParseInt(config["alt_upload_limit"], 10, 64)
+	m.Config.AltSpeed, _ = strconv.ParseBool(config["alt_speed"])
+	m.Config.AltSpeedSchedule, _ = strconv.ParseBool(config["alt_speed_schedule"])
+	m.Config.IncompleteDir = config["incomplete_dir"]
+	m.Config.CompletedDir = config["completed_dir"]
+	m.Config.LabelDirs = parseLabelDirs(config["label_dirs"])
 
 	return nil
 }
@@ -42,11 +135,31 @@ func (m *Model) SaveConfig() error {
 	defer tx.Rollback()
 
 	configs := map[string]string{
-		"download_dir":    m.Config.DownloadDir,
-		"max_connections": strconv.Itoa(m.Config.MaxConnections),
-		"seed_ratio":      fmt.Sprintf("%.2f", m.Config.SeedRatio),
-		"download_limit":  strconv.FormatInt(m.Config.DownloadLimit, 10),
-		"upload_limit":    strconv.FormatInt(m.Config.UploadLimit, 10),
+		"download_dir":         m.Config.DownloadDir,
+		"max_connections":      strconv.Itoa(m.Config.MaxConnections),
+		"seed_ratio":           fmt.Sprintf("%.2f", m.Config.SeedRatio),
+		"download_limit":       strconv.FormatInt(m.Config.DownloadLimit, 10),
+		"upload_limit":         strconv.FormatInt(m.Config.UploadLimit, 10),
+		"seed_time":            strconv.Itoa(m.Config.SeedTime),
+		"listen_port":          strconv.Itoa(m.Config.ListenPort),
+		"auth_username":        m.Config.AuthUsername,
+		"auth_password":        m.Config.AuthPassword,
+		"api_token":            m.Config.APIToken,
+		"tls":                  strconv.FormatBool(m.Config.TLS),
+		"tls_cert":             m.Config.TLSCert,
+		"tls_key":              m.Config.TLSKey,
+		"login_attempts":       strconv.Itoa(m.Config.LoginAttempts),
+		"watch_dirs":           formatWatchDirs(m.Config.WatchDirs),
+		"feed_interval":        strconv.Itoa(m.Config.FeedInterval),
+		"max_active_downloads": strconv.Itoa(m.Config.MaxActiveDownloads),
+		"max_active_seeds":     strconv.Itoa(m.Config.MaxActiveSeeds),
+		"alt_download_limit":   strconv.FormatInt(m.Config.AltDownloadLimit, 10),
+		"alt_upload_limit":     strconv.FormatInt(m.Config.AltUploadLimit, 10),
+		"alt_speed":            strconv.FormatBool(m.Config.AltSpeed),
+		"alt_speed_schedule":   strconv.FormatBool(m.Config.AltSpeedSchedule),
+		"incomplete_dir":       m.Config.IncompleteDir,
+		"completed_dir":        m.Config.CompletedDir,
+		"label_dirs":           formatLabelDirs(m.Config.LabelDirs),
 	}
 
 	for key, value := range configs {
@@ -63,51 +176,220 @@ func (m *Model) SaveConfig() error {
 	return tx.Commit()
 }
 
-func (m *Model) ApplyConfig() {
-	// Close the old client properly
-	if m.Client != nil {
-		m.Client.Close()
-		time.Sleep(3 * time.Second) // Increase the delay if necessary
+// ConfigSnapshot returns a copy of the config. Config is replaced by
+// UpdateConfig while other goroutines run, so everything but the update
+// itself reads it through a snapshot, and changes it from one.
+func (m *Model) ConfigSnapshot() Config {
+	m.configMu.RLock()
+	defer m.configMu.RUnlock()
+	return m.Config
+}
+
+func (m *Model) setConfig(cfg Config) {
+	m.configMu.Lock()
+	m.Config = cfg
+	m.configMu.Unlock()
+}
+
+// UpdateConfig applies cfg to the running client and saves it. It is shared
+// by the config screen and the remote control interfaces.
+func (m *Model) UpdateConfig(cfg Config) error {
+	// Config is only replaced here, so it can be read directly while the
+	// update is applied.
+	m.configUpdateMu.Lock()
+	defer m.configUpdateMu.Unlock()
+
+	prev := m.Config
+	m.setConfig(cfg)
+	if err := m.ApplyConfig(prev); err != nil {
+		return err
 	}
+	return m.SaveConfig()
+}
 
-	// Create new client configuration
-	cfg := torrent.NewDefaultClientConfig()
-	cfg.DataDir = m.Config.DownloadDir
-	cfg.EstablishedConnsPerTorrent = m.Config.MaxConnections
+// ApplyConfig applies m.Config to the running client. Rate limits, connection
+// counts, seeding goals and watch directories take effect immediately. A
+// different download directory or listen port needs a new client, which takes
+// over all torrents with their state; if it can't be created, the previous
+// config is restored.
+func (m *Model) ApplyConfig(prev Config) error {
+	m.applyRateLimits()
 
-	// Create a new client
-	newClient, err := torrent.NewClient(cfg)
-	if err != nil {
-		m.Err = fmt.Errorf("failed to apply new configuration: %v", err)
-		return
+	m.Mu.Lock()
+	m.applyTorrentSettings()
+	m.Mu.Unlock()
+
+	if formatWatchDirs(m.Config.WatchDirs) != formatWatchDirs(prev.WatchDirs) {
+		m.stopWatching()
+		m.startWatching()
+	}
+
+	if m.Config.DownloadDir == prev.DownloadDir && m.Config.ListenPort == prev.ListenPort {
+		m.Notice = "Configuration applied"
+		return nil
+	}
+
+	if err := m.rebuildClient(prev); err != nil {
+		return err
+	}
+	m.Notice = "Configuration applied, torrent client restarted"
+	return nil
+}
+
+// applyTorrentSettings pushes connection limits and seeding goals to the
+// torrents of the running client.
+func (m *Model) applyTorrentSettings() {
+	for infoHash, item := range m.Torrents {
+		if item.State == "paused" || item.State == "queued" || item.State == "moving" {
+			continue
+		}
+		item.Torrent.SetMaxEstablishedConns(m.maxConnections())
+
+		if item.State == "finished" && !m.seedGoalReached(item) {
+			item.Torrent.AllowDataUpload()
+			item.State = "seeding"
+			if err := m.SaveTorrentState(infoHash, item); err != nil {
+				m.Err = err
+			}
+		}
 	}
+	m.applyQueue()
+}
+
+// rebuildClient replaces the torrent client with one built from m.Config and
+// re-adds every torrent, keeping its state, statistics and data location.
+func (m *Model) rebuildClient(prev Config) error {
+	m.moveMu.Lock()
+	defer m.moveMu.Unlock()
 
-	// Store existing torrents
-	existingTorrents := make(map[string]*TorrentItem)
-	for hash, item := range m.Torrents {
-		existingTorrents[hash] = item
+	m.Mu.Lock()
+	stored := make([]storedTorrent, 0, len(m.Torrents))
+	for infoHash, item := range m.Torrents {
+		stored = append(stored, storedTorrentFor(infoHash, item))
 	}
+	m.Torrents = make(map[string]*TorrentItem)
+	m.Cursor = 0
+	m.Mu.Unlock()
 
-	// Set new client
-	m.Client = newClient
+	m.Client.Close()
+	m.closeStorages()
 
-	// Re-add existing torrents to the new client with limited concurrency
-	sem := make(chan struct{}, 5) // Limit to 5 concurrent goroutines
-	var wg sync.WaitGroup
+	client, err := torrent.NewClient(m.newClientConfig())
+	if err != nil {
+		applyErr := fmt.Errorf("failed to apply new configuration: %v", err)
 
-	for _, item := range existingTorrents {
-		if item.MagnetURI != "" {
-			wg.Add(1)
-			go func(item *TorrentItem) {
-				defer wg.Done()
-				sem <- struct{}{}        // Acquire semaphore
-				defer func() { <-sem }() // Release semaphore
-				m.AddTorrent(item.MagnetURI)
-			}(item)
+		m.setConfig(prev)
+		m.applyRateLimits()
+		client, err = torrent.NewClient(m.newClientConfig())
+		if err != nil {
+			return fmt.Errorf("%v; restoring the previous client failed too: %v", applyErr, err)
 		}
+		m.Client = client
+		m.restoreAll(stored)
+		return applyErr
+	}
+
+	m.Client = client
+	m.restoreAll(stored)
+	return nil
+}
+
+func (m *Model) restoreAll(stored []storedTorrent) {
+	for _, st := range stored {
+		go m.restoreTorrent(st, false)
+	}
+}
+
+// storedTorrentFor captures what restoreTorrent needs to bring a live torrent
+// back on another client.
+func storedTorrentFor(infoHash string, item *TorrentItem) storedTorrent {
+	st := storedTorrent{
+		InfoHash:      infoHash,
+		MagnetURI:     item.MagnetURI,
+		State:         item.State,
+		Uploaded:      item.Uploaded,
+		SeedingTime:   int64(item.SeedingTime.Seconds()),
+		SavePath:      item.SavePath,
+		CompletedPath: item.CompletedPath,
+		Label:         item.Label,
+		Queue:         item.QueuePosition,
+		Sequential:    item.Sequential,
+	}
+	if item.Torrent.Info() != nil {
+		st.Metainfo, _ = bencode.Marshal(item.Torrent.Metainfo())
+	}
+	return st
+}
+
+// storageFor returns the storage for torrents kept in dir, opening it on first
+// use. Each directory is opened once, as it holds the piece completion
+// database of everything stored in it.
+func (m *Model) storageFor(dir string) storage.ClientImpl {
+	m.storagesMu.Lock()
+	defer m.storagesMu.Unlock()
+
+	return m.openStorage(dir)
+}
+
+// pieceCompletionFor returns the piece completion database of the storage
+// for dir, which records the pieces the client needn't check on disk.
+func (m *Model) pieceCompletionFor(dir string) storage.PieceCompletion {
+	m.storagesMu.Lock()
+	defer m.storagesMu.Unlock()
+
+	m.openStorage(dir)
+	return m.completions[dir]
+}
+
+// openStorage is storageFor with m.storagesMu held.
+func (m *Model) openStorage(dir string) storage.ClientImpl {
+	if m.storages == nil {
+		m.storages = make(map[string]storage.ClientImplCloser)
+		m.completions = make(map[string]storage.PieceCompletion)
+	}
+	if s, ok := m.storages[dir]; ok {
+		return s
 	}
 
-	wg.Wait()
+	// The database is created in dir, as the storage would do itself.
+	os.MkdirAll(dir, 0o700)
+	completion, err := storage.NewDefaultPieceCompletionForDir(dir)
+	if err != nil {
+		completion = storage.NewMapPieceCompletion()
+	}
+	s := storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		FilePathMaker:   storagePath,
+		PieceCompletion: completion,
+	})
+	m.storages[dir] = s
+	m.completions[dir] = completion
+	return s
+}
 
-	m.Err = fmt.Errorf("New configuration will be applied after restart: %v", err)
+// storagePath is where a file of a torrent is stored, relative to its save
+// path. The single file of a v2 torrent is stored as the file itself, like
+// that of a v1 torrent, rather than in a directory of the same name.
+func storagePath(opts storage.FilePathMakerOpts) string {
+	info := opts.Info
+	if sub, ok := info.FileTree.Dir[info.Name]; ok && info.HasV2() && info.FileTree.NumEntries() == 1 && !sub.IsDir() {
+		return filepath.Join(opts.File.BestPath()...)
+	}
+
+	var parts []string
+	if info.BestName() != metainfo.NoName {
+		parts = append(parts, info.BestName())
+	}
+	return filepath.Join(append(parts, opts.File.BestPath()...)...)
+}
+
+func (m *Model) closeStorages() {
+	m.storagesMu.Lock()
+	defer m.storagesMu.Unlock()
+
+	for dir, s := range m.storages {
+		s.Close()
+		delete(m.storages, dir)
+		delete(m.completions, dir)
+	}
 }
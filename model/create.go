@@ -0,0 +1,409 @@
+package model
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/merkle"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Versions of the BitTorrent protocol a created torrent can be for.
+const (
+	TorrentV1     = "v1"
+	TorrentV2     = "v2"
+	TorrentHybrid = "hybrid"
+)
+
+// minPieceLength is the smallest piece length allowed, the size of a v2 block.
+const minPieceLength = merkle.BlockSize
+
+// CreateOptions describe the torrent CreateTorrent makes.
+type CreateOptions struct {
+	// Version is TorrentV1, TorrentV2 or TorrentHybrid, v1 if empty.
+	Version string
+	// PieceLength is chosen from the total size if 0.
+	PieceLength int64
+	// Trackers are announce URLs, each in a tier of its own.
+	Trackers []string
+	WebSeeds []string
+	Comment  string
+	Private  bool
+	Source   string
+	// Progress, if set, is called with the number of bytes hashed so far.
+	Progress func(hashed, total int64)
+}
+
+// sourceFile is a file below the root of a torrent being created.
+type sourceFile struct {
+	path   []string
+	length int64
+}
+
+// CreateTorrent hashes the file or directory at root into a new torrent.
+// Only regular files are included, in the order of their paths.
+func CreateTorrent(root string, opts CreateOptions) (*metainfo.MetaInfo, error) {
+	if opts.Version == "" {
+		opts.Version = TorrentV1
+	}
+	if opts.Version != TorrentV1 && opts.Version != TorrentV2 && opts.Version != TorrentHybrid {
+		return nil, fmt.Errorf("unknown torrent version %q, expected v1, v2 or hybrid", opts.Version)
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	rootInfo, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []sourceFile
+	if rootInfo.Mode().IsRegular() {
+		files = []sourceFile{{length: rootInfo.Size()}}
+	} else {
+		files, err = sourceFiles(root)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no files found in %s", root)
+		}
+	}
+
+	var total int64
+	for _, f := range files {
+		total += f.length
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("%s holds no data", root)
+	}
+	if opts.PieceLength == 0 {
+		opts.PieceLength = metainfo.ChoosePieceLength(total)
+	}
+	if err := validPieceLength(opts.PieceLength); err != nil {
+		return nil, err
+	}
+
+	info := metainfo.Info{
+		Name:        filepath.Base(root),
+		PieceLength: opts.PieceLength,
+		Source:      opts.Source,
+	}
+	if opts.Private {
+		private := true
+		info.Private = &private
+	}
+
+	c := creator{
+		root:    root,
+		info:    &info,
+		v1:      opts.Version != TorrentV2,
+		v2:      opts.Version != TorrentV1,
+		hybrid:  opts.Version == TorrentHybrid,
+		layers:  make(map[string]string),
+		total:   total,
+		onWrite: opts.Progress,
+	}
+	if err := c.hash(files, rootInfo.Mode().IsRegular()); err != nil {
+		return nil, err
+	}
+
+	infoBytes, err := bencode.Marshal(&info)
+	if err != nil {
+		return nil, err
+	}
+	mi := &metainfo.MetaInfo{
+		InfoBytes:    infoBytes,
+		CreationDate: time.Now().Unix(),
+		CreatedBy:    "RapidTorrent",
+		Comment:      opts.Comment,
+		UrlList:      opts.WebSeeds,
+	}
+	for _, tracker := range opts.Trackers {
+		mi.AnnounceList = append(mi.AnnounceList, []string{tracker})
+	}
+	if len(opts.Trackers) > 0 {
+		mi.Announce = opts.Trackers[0]
+	}
+	if c.v2 && len(c.layers) > 0 {
+		mi.PieceLayers = c.layers
+	}
+	return mi, nil
+}
+
+// sourceFiles lists the regular files below root, ordered by path the way
+// the file tree of a v2 torrent is.
+func sourceFiles(root string) ([]sourceFile, error) {
+	var files []sourceFile
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, sourceFile{path: strings.Split(rel, string(filepath.Separator)), length: fi.Size()})
+		return nil
+	})
+	slices.SortFunc(files, func(a, b sourceFile) int {
+		return slices.Compare(a.path, b.path)
+	})
+	return files, err
+}
+
+func validPieceLength(length int64) error {
+	if length < minPieceLength || length&(length-1) != 0 {
+		return fmt.Errorf("piece size must be a power of two of at least %d KiB", minPieceLength/1024)
+	}
+	return nil
+}
+
+// ParsePieceLength parses a piece size such as "262144", "256K" or "4M".
+// An empty string or "auto" is 0, which has CreateTorrent choose one.
+func ParsePieceLength(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	if s == "" || s == "AUTO" {
+		return 0, nil
+	}
+
+	unit := int64(1)
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	switch {
+	case strings.HasSuffix(s, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		unit = 1 << 20
+	}
+	n, err := strconv.ParseInt(strings.TrimRight(s, "KM"), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid piece size %q", value)
+	}
+	if err := validPieceLength(n * unit); err != nil {
+		return 0, err
+	}
+	return n * unit, nil
+}
+
+// creator hashes the files of a torrent in one pass, building the v1 piece
+// hashes, the v2 file tree and piece layers, or both.
+type creator struct {
+	root   string
+	info   *metainfo.Info
+	v1, v2 bool
+	// hybrid torrents pad every file to a piece boundary, so the v1 and v2
+	// pieces are the same.
+	hybrid bool
+	layers map[string]string
+
+	total, hashed int64
+	onWrite       func(hashed, total int64)
+}
+
+func (c *creator) hash(files []sourceFile, single bool) error {
+	pieceLength := c.info.PieceLength
+	v1 := &pieceHasher{h: sha1.New(), length: pieceLength}
+
+	for i, f := range files {
+		var v2 *pieceHasher
+		if c.v2 {
+			v2 = &pieceHasher{h: merkle.NewHash(), length: pieceLength}
+		}
+
+		if err := c.hashFile(f, v1, v2); err != nil {
+			return err
+		}
+
+		if c.v1 {
+			if single {
+				c.info.Length = f.length
+			} else {
+				c.info.Files = append(c.info.Files, metainfo.FileInfo{Path: f.path, Length: f.length})
+			}
+			if pad := (pieceLength - v1.written) % pieceLength; c.hybrid && pad > 0 && i < len(files)-1 {
+				v1.Write(make([]byte, pad))
+				c.info.Files = append(c.info.Files, metainfo.FileInfo{
+					Path:              []string{".pad", strconv.FormatInt(pad, 10)},
+					Length:            pad,
+					ExtendedFileAttrs: metainfo.ExtendedFileAttrs{Attr: "p"},
+				})
+			}
+		}
+
+		if c.v2 {
+			c.addToFileTree(f, v2)
+		}
+	}
+
+	if c.v1 {
+		c.info.Pieces = v1.finish(v1.h.Sum)
+	}
+	if c.v2 {
+		c.info.MetaVersion = 2
+	}
+	return nil
+}
+
+func (c *creator) hashFile(f sourceFile, v1, v2 *pieceHasher) error {
+	file, err := os.Open(filepath.Join(append([]string{c.root}, f.path...)...))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var writers []io.Writer
+	if c.v1 {
+		writers = append(writers, v1)
+	}
+	if c.v2 {
+		writers = append(writers, v2)
+	}
+	w := io.MultiWriter(append(writers, progressWriter{c})...)
+
+	n, err := io.Copy(w, file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", file.Name(), err)
+	}
+	if n != f.length {
+		return fmt.Errorf("%s changed while it was hashed", file.Name())
+	}
+	return nil
+}
+
+// addToFileTree adds a hashed file to the v2 file tree. Files longer than a
+// piece also get their piece layer.
+func (c *creator) addToFileTree(f sourceFile, v2 *pieceHasher) {
+	entry := metainfo.FileTree{File: metainfo.FileTreeFile{Length: f.length}}
+	if f.length > 0 {
+		mh := v2.h.(*merkle.Hash)
+		// The last piece is padded to a whole piece with zero hashes, unless
+		// it's the only one, which is hashed to its own length.
+		layer := v2.finish(func(b []byte) []byte {
+			if f.length <= c.info.PieceLength {
+				return mh.Sum(b)
+			}
+			return mh.SumMinLength(b, int(c.info.PieceLength))
+		})
+		hashes, _ := merkle.CompactLayerToSliceHashes(string(layer))
+		root := merkle.RootWithPadHash(hashes, metainfo.HashForPiecePad(c.info.PieceLength))
+		entry.File.PiecesRoot = string(root[:])
+		if f.length > c.info.PieceLength {
+			c.layers[entry.File.PiecesRoot] = string(layer)
+		}
+	}
+
+	// A single file is an entry named after the torrent, a directory holds
+	// its files below the torrent name.
+	path := f.path
+	if len(path) == 0 {
+		path = []string{c.info.Name}
+	}
+	insertFile(&c.info.FileTree, path, entry)
+}
+
+func insertFile(tree *metainfo.FileTree, path []string, entry metainfo.FileTree) {
+	if tree.Dir == nil {
+		tree.Dir = make(map[string]metainfo.FileTree)
+	}
+	if len(path) == 1 {
+		tree.Dir[path[0]] = entry
+		return
+	}
+	sub := tree.Dir[path[0]]
+	insertFile(&sub, path[1:], entry)
+	tree.Dir[path[0]] = sub
+}
+
+// pieceHasher hashes a stream piece by piece, starting a new hash at every
+// piece boundary.
+type pieceHasher struct {
+	h       hash.Hash
+	length  int64
+	written int64
+	sums    []byte
+}
+
+func (p *pieceHasher) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) > 0 {
+		chunk := min(int64(len(b)), p.length-p.written)
+		p.h.Write(b[:chunk])
+		p.written += chunk
+		b = b[chunk:]
+		if p.written == p.length {
+			p.sums = p.h.Sum(p.sums)
+			p.h.Reset()
+			p.written = 0
+		}
+	}
+	return n, nil
+}
+
+// finish hashes the last, partial piece with sum and returns all hashes.
+func (p *pieceHasher) finish(sum func([]byte) []byte) []byte {
+	if p.written > 0 {
+		p.sums = sum(p.sums)
+		p.h.Reset()
+		p.written = 0
+	}
+	return p.sums
+}
+
+type progressWriter struct {
+	c *creator
+}
+
+func (w progressWriter) Write(b []byte) (int, error) {
+	w.c.hashed += int64(len(b))
+	if w.c.onWrite != nil {
+		w.c.onWrite(w.c.hashed, w.c.total)
+	}
+	return len(b), nil
+}
+
+// TorrentInfoHash returns the info hash the client knows a torrent by, which
+// for a v2-only torrent is its shortened v2 info hash.
+func TorrentInfoHash(mi *metainfo.MetaInfo) (string, error) {
+	spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+	if err != nil {
+		return "", err
+	}
+	if spec.InfoHash.IsZero() && spec.InfoHashV2.Ok {
+		return spec.InfoHashV2.Value.ToShort().HexString(), nil
+	}
+	return spec.InfoHash.HexString(), nil
+}
+
+// WriteTorrentFile saves a torrent as a .torrent file, refusing to replace
+// an existing one.
+func WriteTorrentFile(path string, mi *metainfo.MetaInfo) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := mi.Write(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
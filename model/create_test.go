@@ -0,0 +1,164 @@
+package model
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// TestCreateTorrent creates a torrent of testdata/create for every version
+// and checks it loads, has the info hash the client knows it by, and verifies
+// against the files it was created from. Of the files, episode.bin spans
+// several pieces and ends in a partial one, extras/notes.txt is shorter than a
+// piece and sample.bin is exactly one.
+func TestCreateTorrent(t *testing.T) {
+	tests := []struct {
+		version string
+		// infoHash is the one the client knows the torrent by, infoHashV2
+		// the full v2 info hash.
+		infoHash, infoHashV2 string
+		// pads are the lengths of the pad files between the v1 files.
+		pads []int64
+	}{
+		{TorrentV1, "f87ba87d2ead8c2c835379c8dc63d5c20cefc6cd", "", nil},
+		{TorrentV2, "f8d7e53bb573fe79b5e1b9624031eacd292ca500", "f8d7e53bb573fe79b5e1b9624031eacd292ca500e4a99b1ca8d6a4cca0deccdf", nil},
+		{TorrentHybrid, "6b072487ab17d092a8cc958dc7a82b0f984cb0ea", "99a6bb278886d8dc9a6592b3fe81cfcc99c493ccff0065580c08858dbd3b592d", []int64{16384 - 40000%16384, 16384 - 100}},
+	}
+
+	cl := newCreateTestClient(t)
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			created, err := CreateTorrent(filepath.Join("testdata", "create"), CreateOptions{
+				Version:     tt.version,
+				PieceLength: 16 << 10,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := created.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			mi, err := metainfo.Load(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			infoHash, err := TorrentInfoHash(mi)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if infoHash != tt.infoHash {
+				t.Errorf("got info hash %s, want %s", infoHash, tt.infoHash)
+			}
+
+			spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var infoHashV2 string
+			if spec.InfoHashV2.Ok {
+				infoHashV2 = spec.InfoHashV2.Value.HexString()
+			}
+			if infoHashV2 != tt.infoHashV2 {
+				t.Errorf("got v2 info hash %s, want %s", infoHashV2, tt.infoHashV2)
+			}
+
+			info, err := mi.UnmarshalInfo()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var pads []int64
+			for _, f := range info.Files {
+				if f.ExtendedFileAttrs.Attr == "p" {
+					pads = append(pads, f.Length)
+				}
+			}
+			if !reflect.DeepEqual(pads, tt.pads) {
+				t.Errorf("got pad files %v, want %v", pads, tt.pads)
+			}
+			if info.HasV2() {
+				if len(mi.PieceLayers) != 1 {
+					t.Errorf("got %d piece layers, want 1 for episode.bin", len(mi.PieceLayers))
+				}
+				if err := metainfo.ValidatePieceLayers(mi.PieceLayers, &info.FileTree, info.PieceLength); err != nil {
+					t.Error(err)
+				}
+			}
+
+			verifyCreated(t, cl, mi)
+		})
+	}
+}
+
+// newCreateTestClient returns a torrent client that doesn't reach out to the
+// network.
+func newCreateTestClient(t *testing.T) *torrent.Client {
+	t.Helper()
+
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.ListenPort = 0
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	cfg.DisableIPv6 = true
+	cl, err := torrent.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+	return cl
+}
+
+// verifyCreated checks a created torrent against a copy of testdata/create,
+// then against the copy with a byte of episode.bin changed.
+func verifyCreated(t *testing.T, cl *torrent.Client, mi *metainfo.MetaInfo) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.CopyFS(filepath.Join(dir, "create"), os.DirFS(filepath.Join("testdata", "create"))); err != nil {
+		t.Fatal(err)
+	}
+	spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	defer files.Close()
+	spec.Storage = files
+
+	tor, _, err := cl.AddTorrentSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tor.Drop()
+	<-tor.GotInfo()
+
+	tor.VerifyData()
+	if got := tor.BytesCompleted(); got != tor.Length() {
+		t.Errorf("verified %d of %d bytes", got, tor.Length())
+	}
+
+	path := filepath.Join(dir, "create", "episode.bin")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tor.VerifyData()
+	if got := tor.BytesCompleted(); got >= tor.Length() {
+		t.Errorf("verified %d of %d bytes with episode.bin changed", got, tor.Length())
+	}
+}
@@ -0,0 +1,216 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Inputs of the create torrent form, in the order they are shown.
+const (
+	createInputPath = iota
+	createInputOutput
+	createInputVersion
+	createInputPieceSize
+	createInputTrackers
+	createInputWebSeeds
+	createInputComment
+	createInputSource
+	createInputPrivate
+	createInputSeed
+)
+
+// torrentCreatedMsg is sent when creating a torrent from the create form is
+// done.
+type torrentCreatedMsg struct {
+	output   string
+	infoHash string
+	seeding  bool
+	err      error
+}
+
+// openCreate shows the form for creating a torrent.
+func (m *Model) openCreate() {
+	m.ShowCreate = true
+	m.CreateInputs = []textinput.Model{
+		newConfigInput("File or Directory", "Enter the path of the data", ""),
+		newConfigInput("Save As", "Defaults to NAME.torrent in the current directory", ""),
+		newConfigInput("Version (v1, v2 or hybrid)", "Enter version", TorrentV1),
+		newConfigInput("Piece Size", "e.g. 256K or 4M, empty to choose one", ""),
+		newConfigInput("Trackers (comma separated)", "Enter announce URLs", ""),
+		newConfigInput("Web Seeds (comma separated)", "Enter web seed URLs", ""),
+		newConfigInput("Comment", "Enter comment", ""),
+		newConfigInput("Source", "Enter source tag", ""),
+		newConfigInput("Private (on/off)", "Enter on or off", "off"),
+		newConfigInput("Seed After Creating (on/off)", "Enter on or off", "on"),
+	}
+	m.CreateInputs[createInputPath].Focus()
+}
+
+// startCreate checks the form and hashes the data in the background.
+func (m *Model) startCreate() tea.Cmd {
+	value := func(i int) string {
+		return strings.TrimSpace(m.CreateInputs[i].Value())
+	}
+
+	root := value(createInputPath)
+	if root == "" {
+		m.Err = fmt.Errorf("enter the file or directory to create a torrent of")
+		return nil
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		m.Err = err
+		return nil
+	}
+	output := value(createInputOutput)
+	if output == "" {
+		output = filepath.Base(root) + ".torrent"
+	}
+	if _, err := os.Stat(output); err == nil {
+		m.Err = fmt.Errorf("%s already exists", output)
+		return nil
+	}
+	pieceLength, err := ParsePieceLength(value(createInputPieceSize))
+	if err != nil {
+		m.Err = err
+		return nil
+	}
+
+	opts := CreateOptions{
+		Version:     value(createInputVersion),
+		PieceLength: pieceLength,
+		Trackers:    splitList(value(createInputTrackers)),
+		WebSeeds:    splitList(value(createInputWebSeeds)),
+		Comment:     value(createInputComment),
+		Source:      value(createInputSource),
+		Private:     isOn(value(createInputPrivate)),
+		Progress: func(hashed, total int64) {
+			m.createHashed.Store(hashed)
+			m.createTotal.Store(total)
+		},
+	}
+	seed := isOn(value(createInputSeed))
+
+	m.Err = nil
+	m.Creating = true
+	m.createHashed.Store(0)
+	m.createTotal.Store(0)
+	return func() tea.Msg {
+		mi, err := CreateTorrent(root, opts)
+		if err != nil {
+			return torrentCreatedMsg{err: err}
+		}
+		if err := WriteTorrentFile(output, mi); err != nil {
+			return torrentCreatedMsg{err: err}
+		}
+		infoHash, err := TorrentInfoHash(mi)
+		if err != nil {
+			return torrentCreatedMsg{err: err}
+		}
+		msg := torrentCreatedMsg{output: output, infoHash: infoHash}
+		if !seed {
+			return msg
+		}
+
+		f, err := os.Open(output)
+		if err != nil {
+			return torrentCreatedMsg{err: err}
+		}
+		defer f.Close()
+		// The data is where it was hashed, so the torrent starts as a seed.
+		if _, _, err := m.AddMetainfoWithOptions(f, AddOptions{SavePath: filepath.Dir(root)}); err != nil {
+			return torrentCreatedMsg{err: err}
+		}
+		msg.seeding = true
+		return msg
+	}
+}
+
+// splitList splits a list of URLs separated by commas or spaces.
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+func (m *Model) updateCreate(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.String() == "ctrl+c" {
+		return m, tea.Quit
+	}
+	if m.Creating {
+		// The form stays until hashing is done.
+		return m, nil
+	}
+
+	switch msg.String() {
+	case "esc":
+		m.ShowCreate = false
+		m.Err = nil
+		return m, nil
+	case "enter":
+		return m, m.startCreate()
+	case "tab", "shift+tab":
+		for i := range m.CreateInputs {
+			if m.CreateInputs[i].Focused() {
+				m.CreateInputs[i].Blur()
+				next := (i + 1) % len(m.CreateInputs)
+				if msg.String() == "shift+tab" {
+					next = (i + len(m.CreateInputs) - 1) % len(m.CreateInputs)
+				}
+				m.CreateInputs[next].Focus()
+				break
+			}
+		}
+		return m, nil
+	}
+
+	var cmds []tea.Cmd
+	for i := range m.CreateInputs {
+		var cmd tea.Cmd
+		m.CreateInputs[i], cmd = m.CreateInputs[i].Update(msg)
+		cmds = append(cmds, cmd)
+	}
+	return m, tea.Batch(cmds...)
+}
+
+func (m *Model) handleCreated(msg torrentCreatedMsg) {
+	m.Creating = false
+	if msg.err != nil {
+		m.Err = msg.err
+		return
+	}
+	m.Err = nil
+	m.ShowCreate = false
+	m.Notice = fmt.Sprintf("Created %s (%s)", msg.output, msg.infoHash)
+	if msg.seeding {
+		m.Notice += ", seeding"
+	}
+}
+
+func (m *Model) createView() string {
+	var s strings.Builder
+	s.WriteString(titleStyle.Render("Create Torrent"))
+	s.WriteString("\n\n")
+	for _, input := range m.CreateInputs {
+		s.WriteString(input.View())
+		s.WriteString("\n")
+	}
+
+	if m.Creating {
+		var done float64
+		if total := m.createTotal.Load(); total > 0 {
+			done = float64(m.createHashed.Load()) / float64(total)
+		}
+		prog := progress.New(progress.WithDefaultGradient(), progress.WithWidth(max(m.Width-16, 20)), progress.WithoutPercentage())
+		s.WriteString(fmt.Sprintf("\nHashing %s %.1f%%", prog.ViewAs(done), done*100))
+		return s.String()
+	}
+	s.WriteString("\nPress Enter to create, Tab to switch fields, Esc to cancel")
+	return s.String()
+}
@@ -8,13 +8,61 @@ import (
 	"strings"
 	"sync"
 	"time"
-)
 
-var (
-	homeDir, _ = os.UserHomeDir()
-	dbPath     = "./rapidtorrent.db"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
 )
 
+var homeDir, _ = os.UserHomeDir()
+
+const dbName = "rapidtorrent.db"
+
+// StateDir returns the per-user directory holding the database and the files
+// the running instance is found by, creating it if needed.
+func StateDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "rapidtorrent")
+	return dir, os.MkdirAll(dir, 0o700)
+}
+
+// StateFile returns the path of a file kept in the state directory. Earlier
+// versions kept their files in the working directory, a file of that name
+// left there is moved over once, unless the state directory has one already.
+func StateFile(name string) (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		return path, nil
+	}
+	if _, err := os.Stat(name); err != nil {
+		return path, nil
+	}
+	if err := moveFile(name, path); err != nil {
+		return "", fmt.Errorf("failed to move %s to %s: %v", name, dir, err)
+	}
+	return path, nil
+}
+
+func databasePath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(dir, dbName)); os.IsNotExist(err) {
+		// A journal left behind by a crash is part of the database.
+		if _, err := StateFile(dbName + "-journal"); err != nil {
+			return "", err
+		}
+	}
+	return StateFile(dbName)
+}
+
 func initDatabase(db *sql.DB) error {
 	schema := `
 	CREATE TABLE IF NOT EXISTS torrents (
@@ -24,6 +72,10 @@ func initDatabase(db *sql.DB) error {
 		name TEXT,
 		progress REAL DEFAULT 0,
 		state TEXT DEFAULT 'pending',
+		uploaded INTEGER DEFAULT 0,
+		metainfo BLOB,
+		seeding_time INTEGER DEFAULT 0,
+		save_path TEXT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
@@ -37,6 +89,39 @@ func initDatabase(db *sql.DB) error {
 		FOREIGN KEY(torrent_id) REFERENCES torrents(id)
 	);
 
+	CREATE TABLE IF NOT EXISTS torrent_files (
+		info_hash TEXT,
+		file_index INTEGER,
+		priority TEXT,
+		PRIMARY KEY (info_hash, file_index)
+	);
+
+	CREATE TABLE IF NOT EXISTS feeds (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT UNIQUE NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		include TEXT NOT NULL DEFAULT '',
+		exclude TEXT NOT NULL DEFAULT '',
+		download_dir TEXT NOT NULL DEFAULT '',
+		label TEXT NOT NULL DEFAULT '',
+		last_checked TIMESTAMP,
+		last_error TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE TABLE IF NOT EXISTS feed_history (
+		guid TEXT PRIMARY KEY,
+		feed_id INTEGER,
+		title TEXT,
+		episode TEXT,
+		added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS speed_schedule (
+		day INTEGER,
+		hour INTEGER,
+		PRIMARY KEY (day, hour)
+	);
+
 	CREATE TABLE IF NOT EXISTS config (
         key TEXT PRIMARY KEY,
         value TEXT,
@@ -45,16 +130,44 @@ func initDatabase(db *sql.DB) error {
 
 	CREATE INDEX IF NOT EXISTS idx_torrents_info_hash ON torrents(info_hash);
 	CREATE INDEX IF NOT EXISTS idx_history_torrent_id ON torrent_history(torrent_id);
+	CREATE INDEX IF NOT EXISTS idx_feed_history_episode ON feed_history(episode);
 	`
 
 	_, err := db.Exec(schema)
+	if err != nil {
+		return err
+	}
+
+	if err := migrateDatabase(db); err != nil {
+		return err
+	}
 
 	defaultConfig := map[string]string{
-		"download_dir":    filepath.Join(homeDir, "Downloads"),
-		"max_connections": "50",
-		"seed_ratio":      "1.5",
-		"download_limit":  "0",
-		"upload_limit":    "0",
+		"download_dir":         filepath.Join(homeDir, "Downloads"),
+		"max_connections":      "50",
+		"seed_ratio":           "1.5",
+		"download_limit":       "0",
+		"upload_limit":         "0",
+		"seed_time":            "0",
+		"listen_port":          "42069",
+		"auth_username":        "admin",
+		"auth_password":        "",
+		"api_token":            "",
+		"tls":                  "false",
+		"tls_cert":             "",
+		"tls_key":              "",
+		"login_attempts":       "5",
+		"watch_dirs":           "",
+		"feed_interval":        "15",
+		"max_active_downloads": "3",
+		"max_active_seeds":     "5",
+		"alt_download_limit":   "50",
+		"alt_upload_limit":     "50",
+		"alt_speed":            "false",
+		"alt_speed_schedule":   "false",
+		"incomplete_dir":       "",
+		"completed_dir":        "",
+		"label_dirs":           "",
 	}
 
 	for key, value := range defaultConfig {
@@ -70,6 +183,39 @@ func initDatabase(db *sql.DB) error {
 	return err
 }
 
+// torrentColumns lists columns added to the torrents table after it was first
+// created, so databases from older versions can be upgraded in place.
+var torrentColumns = []struct {
+	name string
+	def  string
+}{
+	{"uploaded", "INTEGER DEFAULT 0"},
+	{"metainfo", "BLOB"},
+	{"seeding_time", "INTEGER DEFAULT 0"},
+	{"save_path", "TEXT"},
+	{"label", "TEXT"},
+	{"queue_position", "INTEGER DEFAULT 0"},
+	{"sequential", "INTEGER DEFAULT 0"},
+	{"completed_path", "TEXT"},
+}
+
+func migrateDatabase(db *sql.DB) error {
+	for _, col := range torrentColumns {
+		_, err := db.Exec(fmt.Sprintf("ALTER TABLE torrents ADD COLUMN %s %s", col.name, col.def))
+		if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return fmt.Errorf("failed to add column %s: %v", col.name, err)
+		}
+	}
+
+	// Torrents from before the queue existed are queued in the order they
+	// were added.
+	_, err := db.Exec("UPDATE torrents SET queue_position = id WHERE queue_position IS NULL OR queue_position = 0")
+	if err != nil {
+		return fmt.Errorf("failed to set queue positions: %v", err)
+	}
+	return nil
+}
+
 func GetConfigValue(db *sql.DB, key string) (string, error) {
 	var value string
 	err := db.QueryRow("SELECT value FROM config WHERE key = ?", key).Scan(&value)
@@ -96,6 +242,12 @@ func CheckConfigExists(db *sql.DB) (bool, error) {
 var dbMutex sync.Mutex
 
 func (m *Model) SaveTorrentState(infoHash string, item *TorrentItem) error {
+	// A moved torrent is saved with its new path once the move is done,
+	// until then the state from before the move stays.
+	if item.State == "moving" {
+		return nil
+	}
+
 	dbMutex.Lock()
 	defer dbMutex.Unlock()
 
@@ -124,28 +276,57 @@ func (m *Model) ExecuteSaveTorrent(infoHash string, item *TorrentItem) error {
 	defer tx.Rollback()
 
 	query := `
-        INSERT INTO torrents (info_hash, magnet_uri, name, progress, state, updated_at)
-        VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+        INSERT INTO torrents (info_hash, magnet_uri, name, progress, state, uploaded, seeding_time, save_path, completed_path, label, queue_position, sequential, updated_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
         ON CONFLICT(info_hash) DO UPDATE SET
             progress = ?,
             state = ?,
+            uploaded = ?,
+            seeding_time = ?,
+            save_path = ?,
+            completed_path = ?,
+            label = ?,
+            queue_position = ?,
+            sequential = ?,
             updated_at = CURRENT_TIMESTAMP
     `
 
+	seedingTime := int64(item.SeedingTime.Seconds())
 	_, err = tx.Exec(query,
 		infoHash,
 		item.MagnetURI,
 		item.Name,
 		item.Progress,
 		item.State,
+		item.Uploaded,
+		seedingTime,
+		item.SavePath,
+		item.CompletedPath,
+		item.Label,
+		item.QueuePosition,
+		item.Sequential,
 		item.Progress,
 		item.State,
+		item.Uploaded,
+		seedingTime,
+		item.SavePath,
+		item.CompletedPath,
+		item.Label,
+		item.QueuePosition,
+		item.Sequential,
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to save torrent state: %v", err)
 	}
 
+	if item.ID == 0 {
+		err = tx.QueryRow("SELECT id FROM torrents WHERE info_hash = ?", infoHash).Scan(&item.ID)
+		if err != nil {
+			return fmt.Errorf("failed to load torrent id: %v", err)
+		}
+	}
+
 	historyQuery := `
         INSERT INTO torrent_history (torrent_id, status, progress)
         SELECT id, ?, ? FROM torrents WHERE info_hash = ?
@@ -158,11 +339,166 @@ func (m *Model) ExecuteSaveTorrent(infoHash string, item *TorrentItem) error {
 	return tx.Commit()
 }
 
+// SaveTorrentMetainfo stores the full .torrent of a torrent once its info is
+// known, so restoring it doesn't depend on peers handing out metadata.
+func (m *Model) SaveTorrentMetainfo(infoHash string, mi metainfo.MetaInfo) error {
+	data, err := bencode.Marshal(mi)
+	if err != nil {
+		return fmt.Errorf("failed to encode metainfo: %v", err)
+	}
+
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	_, err = m.DB.Exec(`
+        UPDATE torrents
+        SET metainfo = ?, updated_at = CURRENT_TIMESTAMP
+        WHERE info_hash = ?
+    `, data, infoHash)
+	if err != nil {
+		return fmt.Errorf("failed to save metainfo: %v", err)
+	}
+	return nil
+}
+
+func (m *Model) SaveFilePriority(infoHash string, index int, priority string) error {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	_, err := m.DB.Exec(`
+        INSERT INTO torrent_files (info_hash, file_index, priority)
+        VALUES (?, ?, ?)
+        ON CONFLICT(info_hash, file_index) DO UPDATE SET priority = excluded.priority
+    `, infoHash, index, priority)
+	if err != nil {
+		return fmt.Errorf("failed to save file priority: %v", err)
+	}
+	return nil
+}
+
+// SaveQueuePositions stores the queue positions of torrents by info hash.
+func (m *Model) SaveQueuePositions(positions map[string]int) error {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for infoHash, position := range positions {
+		_, err := tx.Exec("UPDATE torrents SET queue_position = ? WHERE info_hash = ?", position, infoHash)
+		if err != nil {
+			return fmt.Errorf("failed to save queue position: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadFilePriorities returns the saved file priorities of a torrent by file
+// index. Files that were never changed have no entry.
+func (m *Model) LoadFilePriorities(infoHash string) (map[int]string, error) {
+	rows, err := m.DB.Query("SELECT file_index, priority FROM torrent_files WHERE info_hash = ?", infoHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	priorities := make(map[int]string)
+	for rows.Next() {
+		var index int
+		var priority string
+		if err := rows.Scan(&index, &priority); err != nil {
+			return nil, err
+		}
+		priorities[index] = priority
+	}
+	return priorities, rows.Err()
+}
+
+func (m *Model) DeleteTorrentState(infoHash string) error {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+        DELETE FROM torrent_history
+        WHERE torrent_id IN (SELECT id FROM torrents WHERE info_hash = ?)
+    `, infoHash)
+	if err != nil {
+		return fmt.Errorf("failed to delete torrent history: %v", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM torrent_files WHERE info_hash = ?", infoHash)
+	if err != nil {
+		return fmt.Errorf("failed to delete file priorities: %v", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM torrents WHERE info_hash = ?", infoHash)
+	if err != nil {
+		return fmt.Errorf("failed to delete torrent: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// storedTorrent holds the columns of a torrents row needed to restore it.
+type storedTorrent struct {
+	InfoHash    string
+	MagnetURI   string
+	State       string
+	Uploaded    int64
+	SeedingTime int64
+	SavePath    string
+	// CompletedPath is where the data is moved once complete.
+	CompletedPath string
+	Label         string
+	Queue         int
+	Sequential    bool
+	Metainfo      []byte
+}
+
+// restoreStats gives the new item of a stored torrent the upload, seeding
+// time, queue position and sequential mode it had, before it is first saved.
+func (st storedTorrent) restoreStats(item *TorrentItem) {
+	item.UploadedBase = st.Uploaded
+	item.Uploaded = st.Uploaded
+	item.SeedingTime = time.Duration(st.SeedingTime) * time.Second
+	if st.Queue > 0 {
+		item.QueuePosition = st.Queue
+	}
+	item.Sequential = st.Sequential
+}
+
+// restoreState puts the new item of a stored torrent back in the state it
+// was saved in, before the queue or awaitInfo get to start it. A paused
+// torrent stays paused, a finished one doesn't upload until its seeding goal
+// is raised, and a completed one is held as verifying when verify is set,
+// until verifySeed has checked its data.
+func (st storedTorrent) restoreState(item *TorrentItem, verify bool) {
+	switch st.State {
+	case "paused":
+		pauseItem(item)
+	case "finished":
+		item.Torrent.DisallowDataUpload()
+		item.State = "finished"
+	case "seeding", "completed", "verifying":
+		if verify {
+			item.State = "verifying"
+		}
+	}
+}
+
 func (m *Model) RestoreActiveTorrents() error {
 	query := `
-		SELECT info_hash, magnet_uri, name, progress, state
+		SELECT info_hash, magnet_uri, state, uploaded, seeding_time, COALESCE(save_path, ''), COALESCE(completed_path, ''), COALESCE(label, ''), COALESCE(queue_position, 0), COALESCE(sequential, 0), metainfo
 		FROM torrents
-		WHERE state != 'completed'
 	`
 
 	rows, err := m.DB.Query(query)
@@ -172,16 +508,48 @@ func (m *Model) RestoreActiveTorrents() error {
 	defer rows.Close()
 
 	for rows.Next() {
-		var infoHash, magnetURI, name, state string
-		var progress float64
-		if err := rows.Scan(&infoHash, &magnetURI, &name, &progress, &state); err != nil {
+		var st storedTorrent
+		if err := rows.Scan(&st.InfoHash, &st.MagnetURI, &st.State, &st.Uploaded, &st.SeedingTime, &st.SavePath, &st.CompletedPath, &st.Label, &st.Queue, &st.Sequential, &st.Metainfo); err != nil {
 			return err
 		}
-
-		if state != "completed" {
-			go m.AddTorrent(magnetURI)
+		if st.SavePath == "" {
+			st.SavePath = m.dataDir()
 		}
+
+		go m.restoreTorrent(st, true)
 	}
 
 	return rows.Err()
 }
+
+// restoreTorrent re-adds a torrent saved by a previous session, carrying over
+// its upload and seeding time so the seeding goal survives restarts. Stored
+// metainfo is preferred, the magnet link is only used when there is none.
+// With verify set, completed torrents are hashed against the data on disk
+// before they are seeded again.
+func (m *Model) restoreTorrent(st storedTorrent, verify bool) {
+	restore := func(item *TorrentItem) {
+		st.restoreStats(item)
+		st.restoreState(item, verify)
+	}
+
+	opts := AddOptions{SavePath: st.SavePath, Label: st.Label}
+	if len(st.Metainfo) == 0 {
+		if _, _, err := m.addMagnet(st.MagnetURI, opts, st.CompletedPath, restore); err != nil {
+			m.Err = err
+			return
+		}
+	} else if err := m.addStoredTorrent(st, restore); err != nil {
+		m.Err = err
+		if _, _, err := m.addMagnet(st.MagnetURI, opts, st.CompletedPath, restore); err != nil {
+			return
+		}
+	}
+
+	switch st.State {
+	case "seeding", "completed", "verifying":
+		if verify {
+			m.verifySeed(st.InfoHash)
+		}
+	}
+}
@@ -0,0 +1,484 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"main/utils"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/tracker"
+	"github.com/anacrolix/torrent/types/infohash"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Tabs of the detail pane, in the order they are cycled through.
+const (
+	tabFiles = iota
+	tabPeers
+	tabTrackers
+	tabPieces
+)
+
+var tabNames = []string{"Files", "Peers", "Trackers", "Pieces"}
+
+// scrapeInterval is how long tracker statistics are shown before the
+// trackers are asked again.
+const scrapeInterval = time.Minute
+
+var (
+	activeTabStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("#FFFFFF")).
+			Background(lipgloss.Color("#FF75B7")).
+			Padding(0, 1)
+
+	inactiveTabStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("#9F72FF")).
+				Padding(0, 1)
+)
+
+// TrackerStatus is the result of an announce to and a scrape of one of the
+// trackers of a torrent, made when its trackers are shown. The client keeps
+// the results of its own announces to itself.
+type TrackerStatus struct {
+	URL string `json:"url"`
+	// Announce is the result of the announce, e.g. the number of peers
+	// received, and NextAnnounce when the tracker wants the next one.
+	Announce     string    `json:"announce"`
+	NextAnnounce time.Time `json:"next_announce"`
+	Status       string    `json:"status"`
+	Seeders      int       `json:"seeders"`
+	Leechers     int       `json:"leechers"`
+	Updated      time.Time `json:"updated"`
+}
+
+// openDetails shows the detail pane of the selected torrent on the given tab.
+func (m *Model) openDetails(tab int) {
+	m.Mu.RLock()
+	infoHash := m.selectedHash()
+	m.Mu.RUnlock()
+	if infoHash == "" {
+		return
+	}
+
+	m.ShowDetails = true
+	m.DetailHash = infoHash
+	m.DetailTab = tab
+	m.FileCursor = 0
+	m.collapsedDirs = nil
+	m.Viewport.GotoTop()
+	m.refreshTrackers()
+}
+
+func (m *Model) updateDetails(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.Mu.RLock()
+	item, exists := m.Torrents[m.DetailHash]
+	m.Mu.RUnlock()
+	if !exists {
+		m.ShowDetails = false
+		return m, nil
+	}
+
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return m, tea.Quit
+	case "esc":
+		m.ShowDetails = false
+		return m, nil
+	case "tab":
+		m.DetailTab = (m.DetailTab + 1) % len(tabNames)
+		m.Viewport.GotoTop()
+		m.refreshTrackers()
+		return m, nil
+	case "shift+tab":
+		m.DetailTab = (m.DetailTab + len(tabNames) - 1) % len(tabNames)
+		m.Viewport.GotoTop()
+		m.refreshTrackers()
+		return m, nil
+	}
+
+	if m.DetailTab == tabFiles && item.Torrent.Info() != nil {
+		m.handleFileKey(msg.String(), item.Torrent.Files())
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.Viewport, cmd = m.Viewport.Update(msg)
+	return m, cmd
+}
+
+// refreshTrackers scrapes the trackers of the torrent in the detail pane in
+// the background, unless that happened recently.
+func (m *Model) refreshTrackers() {
+	if m.DetailTab != tabTrackers {
+		return
+	}
+
+	m.Mu.Lock()
+	item, exists := m.Torrents[m.DetailHash]
+	if !exists || time.Since(item.TrackersScraped) < scrapeInterval {
+		m.Mu.Unlock()
+		return
+	}
+	item.TrackersScraped = time.Now()
+	infoHash := m.DetailHash
+	t := item.Torrent
+	cl := m.Client
+
+	// The announces are those of the client, so the trackers don't see
+	// another peer.
+	req := tracker.AnnounceRequest{
+		InfoHash:   t.InfoHash(),
+		PeerId:     cl.PeerID(),
+		Downloaded: item.Downloaded,
+		Uploaded:   item.Uploaded,
+		Left:       -1,
+		NumWant:    -1,
+		Port:       uint16(cl.LocalPort()),
+	}
+	if t.Info() != nil {
+		req.Left = t.Length() - t.BytesCompleted()
+	}
+	m.Mu.Unlock()
+
+	go func() {
+		statuses := scrapeTrackers(t, req)
+
+		m.Mu.Lock()
+		defer m.Mu.Unlock()
+		if item, exists := m.Torrents[infoHash]; exists {
+			item.Trackers = statuses
+		}
+	}()
+}
+
+// trackerURLs returns the distinct announce URLs of a torrent.
+func trackerURLs(t *torrent.Torrent) []string {
+	mi := t.Metainfo()
+	seen := make(map[string]bool)
+	var urls []string
+	for _, tier := range mi.UpvertedAnnounceList() {
+		for _, url := range tier {
+			if !seen[url] {
+				seen[url] = true
+				urls = append(urls, url)
+			}
+		}
+	}
+	return urls
+}
+
+// scrapeTrackers announces req to every tracker of a torrent and scrapes it.
+func scrapeTrackers(t *torrent.Torrent, req tracker.AnnounceRequest) []TrackerStatus {
+	urls := trackerURLs(t)
+	statuses := make([]TrackerStatus, len(urls))
+	done := make(chan struct{})
+
+	for i, url := range urls {
+		go func(i int, url string) {
+			defer func() { done <- struct{}{} }()
+			statuses[i] = scrapeTracker(url, req)
+		}(i, url)
+	}
+	for range urls {
+		<-done
+	}
+	return statuses
+}
+
+func scrapeTracker(url string, req tracker.AnnounceRequest) TrackerStatus {
+	status := TrackerStatus{URL: url, Updated: time.Now()}
+
+	cl, err := tracker.NewClient(url, tracker.NewClientOpts{})
+	if err != nil {
+		status.Status = err.Error()
+		return status
+	}
+	defer cl.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if ann, err := cl.Announce(ctx, req, tracker.AnnounceOpt{}); err != nil {
+		status.Announce = err.Error()
+	} else {
+		status.Announce = fmt.Sprintf("%d peers", len(ann.Peers))
+		status.NextAnnounce = time.Now().Add(time.Duration(ann.Interval) * time.Second)
+	}
+
+	resp, err := cl.Scrape(ctx, []infohash.T{req.InfoHash})
+	switch {
+	case err != nil:
+		status.Status = err.Error()
+	case len(resp) == 0:
+		status.Status = "no scrape data"
+	default:
+		status.Status = "working"
+		status.Seeders = int(resp[0].Seeders)
+		status.Leechers = int(resp[0].Leechers)
+	}
+	status.Updated = time.Now()
+	return status
+}
+
+func (m *Model) detailsView() string {
+	item, exists := m.Torrents[m.DetailHash]
+	if !exists {
+		return ""
+	}
+
+	var s strings.Builder
+	s.WriteString(titleStyle.Render(item.Name))
+	s.WriteString("\n\n")
+
+	var tabs []string
+	for i, name := range tabNames {
+		if i == m.DetailTab {
+			tabs = append(tabs, activeTabStyle.Render(name))
+		} else {
+			tabs = append(tabs, inactiveTabStyle.Render(name))
+		}
+	}
+	s.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, tabs...))
+	s.WriteString("\n")
+
+	var content, help string
+	switch {
+	case item.Torrent.Info() == nil:
+		content = "Fetching metadata..."
+		help = "Tab to switch tabs, Esc to go back"
+	case m.DetailTab == tabFiles:
+		content = m.filesView(item)
+		help = "Space to toggle, 's' skip, 'n' normal, 'h' high priority, Enter or ←/→ to collapse folders, Tab to switch tabs, Esc to go back"
+		if file := m.selectedFile(item.Torrent.Files()); file >= 0 {
+			if u := m.StreamFileURL(m.DetailHash, file); u != "" {
+				help += "\nStream: " + u
+			}
+		}
+	case m.DetailTab == tabPeers:
+		content = m.peersView(item)
+		help = "Tab to switch tabs, Esc to go back"
+	case m.DetailTab == tabTrackers:
+		content = trackersView(item)
+		help = "Tab to switch tabs, Esc to go back"
+	case m.DetailTab == tabPieces:
+		content = m.piecesView(item)
+		help = "Tab to switch tabs, Esc to go back"
+	}
+
+	m.Viewport.SetContent(content)
+	if m.DetailTab == tabFiles {
+		m.scrollToLine(m.FileCursor, 1)
+	}
+	s.WriteString(m.Viewport.View())
+	s.WriteString("\n\n")
+	s.WriteString(help)
+
+	return s.String()
+}
+
+func (m *Model) filesView(item *TorrentItem) string {
+	files := item.Torrent.Files()
+	var content strings.Builder
+	for i, row := range m.fileRows(files) {
+		var length, completed int64
+		for _, f := range row.files {
+			length += files[f].Length()
+			completed += files[f].BytesCompleted()
+		}
+		progress := 0.0
+		if length > 0 {
+			progress = float64(completed) / float64(length) * 100
+		}
+
+		check := "[x]"
+		switch filesSelected(files, row.files) {
+		case 0:
+			check = "[ ]"
+		case len(row.files):
+		default:
+			check = "[-]"
+		}
+
+		name := row.name
+		var priority string
+		if row.isDir() {
+			marker := "▾ "
+			if m.collapsedDirs[row.dir] {
+				marker = "▸ "
+			}
+			name = marker + name + "/"
+		} else {
+			priority = " • " + FilePriorityName(files[row.files[0]].Priority())
+		}
+
+		line := fmt.Sprintf("%s %s%s • %s • %.1f%%%s",
+			check, strings.Repeat("  ", row.depth), name, utils.FormatBytes(length), progress, priority)
+		if i == m.FileCursor {
+			content.WriteString(selectedStyle.Render("> " + line))
+		} else {
+			content.WriteString("  " + line)
+		}
+		content.WriteString("\n")
+	}
+	return content.String()
+}
+
+// peerFlags describes how a peer was found and connected to: its source,
+// the transport, and "E" if it prefers encryption.
+func peerFlags(pc *torrent.PeerConn) string {
+	flags := string(pc.Discovery) + " " + pc.Network
+	if pc.PeerPrefersEncryption {
+		flags += " E"
+	}
+	return flags
+}
+
+func (m *Model) peersView(item *TorrentItem) string {
+	conns := item.Torrent.PeerConns()
+	if len(conns) == 0 {
+		return "No connected peers"
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].DownloadRate() > conns[j].DownloadRate()
+	})
+
+	numPieces := item.Torrent.NumPieces()
+
+	var content strings.Builder
+	content.WriteString(fmt.Sprintf("%-40s %-20s %12s %12s %8s  %s\n", "Address", "Client", "↓ Rate", "↑ Rate (est)", "Has", "Flags"))
+	for _, pc := range conns {
+		client, _ := pc.PeerClientName.Load().(string)
+		if client == "" {
+			client = "unknown"
+		}
+
+		has := 0.0
+		if numPieces > 0 {
+			has = float64(pc.PeerPieces().GetCardinality()) / float64(numPieces) * 100
+		}
+
+		upload := 0.0
+		if uploadsAllowed(item) {
+			upload = m.peerUploads.rate(pc)
+		}
+
+		content.WriteString(fmt.Sprintf("%-40s %-20.20s %10s/s %10s/s %7.1f%%  %s\n",
+			pc.RemoteAddr.String(), client, utils.FormatBytes(int64(pc.DownloadRate())),
+			utils.FormatBytes(int64(upload)), has, peerFlags(pc)))
+	}
+	return content.String()
+}
+
+func trackersView(item *TorrentItem) string {
+	urls := trackerURLs(item.Torrent)
+	if len(urls) == 0 {
+		return "No trackers"
+	}
+
+	statuses := make(map[string]TrackerStatus)
+	for _, status := range item.Trackers {
+		statuses[status.URL] = status
+	}
+
+	var content strings.Builder
+	for _, url := range urls {
+		content.WriteString(url)
+		content.WriteString("\n")
+
+		status, ok := statuses[url]
+		if !ok {
+			content.WriteString("    Status: updating...\n")
+			continue
+		}
+		announce := status.Announce
+		if announce == "" {
+			announce = "not announced"
+		}
+		next := "due"
+		if wait := time.Until(status.NextAnnounce); wait > 0 {
+			next = "in " + wait.Round(time.Second).String()
+		}
+		content.WriteString(fmt.Sprintf("    Announce: %s • Next announce: %s\n", announce, next))
+		content.WriteString(fmt.Sprintf("    Scrape: %s • Seeds: %d • Leeches: %d\n",
+			status.Status, status.Seeders, status.Leechers))
+	}
+	return content.String()
+}
+
+// piecesView draws one cell per piece, or per group of pieces if there are
+// more pieces than fit. Complete cells are filled, partial ones shaded and
+// missing ones show how many connected peers have them.
+func (m *Model) piecesView(item *TorrentItem) string {
+	t := item.Torrent
+	numPieces := t.NumPieces()
+	if numPieces == 0 {
+		return "No pieces"
+	}
+
+	availability := make([]int, numPieces)
+	for _, pc := range t.PeerConns() {
+		it := pc.PeerPieces().Iterator()
+		for it.HasNext() {
+			if i := int(it.Next()); i < numPieces {
+				availability[i]++
+			}
+		}
+	}
+
+	width := m.Viewport.Width - m.Viewport.Style.GetHorizontalFrameSize()
+	if width < 10 {
+		width = 10
+	}
+	cells := width * 10
+	if cells > numPieces {
+		cells = numPieces
+	}
+
+	var content strings.Builder
+	for cell := 0; cell < cells; cell++ {
+		begin := cell * numPieces / cells
+		end := (cell + 1) * numPieces / cells
+
+		allComplete, partial := true, false
+		minAvailable := -1
+		for i := begin; i < end; i++ {
+			state := t.PieceState(i)
+			if state.Complete {
+				continue
+			}
+			allComplete = false
+			if state.Partial || state.Checking {
+				partial = true
+			}
+			if minAvailable < 0 || availability[i] < minAvailable {
+				minAvailable = availability[i]
+			}
+		}
+
+		switch {
+		case allComplete:
+			content.WriteString("█")
+		case partial:
+			content.WriteString("▒")
+		case minAvailable == 0:
+			content.WriteString("·")
+		case minAvailable > 9:
+			content.WriteString("+")
+		default:
+			content.WriteString(fmt.Sprint(minAvailable))
+		}
+		if (cell+1)%width == 0 {
+			content.WriteString("\n")
+		}
+	}
+
+	content.WriteString(fmt.Sprintf("\n\n%d pieces of %s • █ complete • ▒ partial • 1-9 peers with the piece • · unavailable\n",
+		numPieces, utils.FormatBytes(t.Info().PieceLength)))
+	return content.String()
+}
@@ -0,0 +1,438 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// feedCheckInterval is how often the poller looks for feeds that are due.
+	feedCheckInterval = time.Minute
+	feedTimeout       = 30 * time.Second
+	maxFeedSize       = 10 << 20
+)
+
+// Match states of feed items, as shown in the preview.
+const (
+	FeedItemMatch    = "match"
+	FeedItemFiltered = "filtered"
+	FeedItemSeen     = "seen"
+)
+
+// Feed is an RSS or Atom feed whose matching items are added automatically.
+// Include and Exclude are case-insensitive regular expressions matched
+// against item titles; an empty Include matches everything.
+type Feed struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"`
+	Name        string    `json:"name"`
+	Include     string    `json:"include"`
+	Exclude     string    `json:"exclude"`
+	DownloadDir string    `json:"download_dir"`
+	Label       string    `json:"label"`
+	LastChecked time.Time `json:"last_checked"`
+	LastError   string    `json:"last_error"`
+}
+
+// FeedItem is an entry of a feed. Link is a magnet link or the URL of a
+// .torrent file.
+type FeedItem struct {
+	Title string `json:"title"`
+	GUID  string `json:"guid"`
+	Link  string `json:"link"`
+}
+
+// FeedMatch is a feed item along with what a check would do with it.
+type FeedMatch struct {
+	Item   FeedItem `json:"item"`
+	Status string   `json:"status"`
+}
+
+// episodePatterns find the show and episode in release titles, in the
+// S01E02 and 1x02 styles.
+var episodePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^(.+?)[\s._-]+s(\d{1,2})[\s._-]?e(\d{1,3})`),
+	regexp.MustCompile(`(?i)^(.+?)[\s._-]+(\d{1,2})x(\d{2,3})`),
+}
+
+var nonAlnum = regexp.MustCompile(`[^a-z0-9]+`)
+
+// episodeKey identifies the episode a release title is for, so different
+// releases of the same episode are only added once. Titles without an
+// episode number have no key.
+func episodeKey(title string) string {
+	for _, re := range episodePatterns {
+		match := re.FindStringSubmatch(title)
+		if match == nil {
+			continue
+		}
+		show := strings.Trim(nonAlnum.ReplaceAllString(strings.ToLower(match[1]), " "), " ")
+		var season, episode int
+		fmt.Sscan(match[2], &season)
+		fmt.Sscan(match[3], &episode)
+		return fmt.Sprintf("%s s%02de%02d", show, season, episode)
+	}
+	return ""
+}
+
+func compileFeedPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	return re, nil
+}
+
+// Validate checks the URL and the filter patterns of the feed.
+func (f Feed) Validate() error {
+	if !strings.HasPrefix(f.URL, "http://") && !strings.HasPrefix(f.URL, "https://") {
+		return fmt.Errorf("feed URL must start with http:// or https://")
+	}
+	if _, err := compileFeedPattern(f.Include); err != nil {
+		return err
+	}
+	_, err := compileFeedPattern(f.Exclude)
+	return err
+}
+
+// Matches reports whether an item title passes the filters of the feed.
+func (f Feed) Matches(title string) bool {
+	include, err := compileFeedPattern(f.Include)
+	if err != nil {
+		return false
+	}
+	exclude, err := compileFeedPattern(f.Exclude)
+	if err != nil {
+		return false
+	}
+	if include != nil && !include.MatchString(title) {
+		return false
+	}
+	return exclude == nil || !exclude.MatchString(title)
+}
+
+type rssItem struct {
+	Title     string `xml:"title"`
+	Link      string `xml:"link"`
+	GUID      string `xml:"guid"`
+	MagnetURI string `xml:"magnetURI"`
+	Enclosure struct {
+		URL string `xml:"url,attr"`
+	} `xml:"enclosure"`
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	ID    string `xml:"id"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+}
+
+// feedDocument holds both RSS and Atom feeds; only one of them is filled.
+type feedDocument struct {
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// parseFeed reads the items of an RSS 2.0 or Atom feed. The torrent of an
+// item is taken from a magnet link if there is one, then from an enclosure,
+// then from the item link.
+func parseFeed(r io.Reader) ([]FeedItem, error) {
+	var doc feedDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %v", err)
+	}
+
+	var items []FeedItem
+	for _, it := range doc.Channel.Items {
+		item := FeedItem{Title: strings.TrimSpace(it.Title), GUID: strings.TrimSpace(it.GUID)}
+		for _, link := range []string{it.MagnetURI, it.Enclosure.URL, it.Link} {
+			link = strings.TrimSpace(link)
+			if strings.HasPrefix(link, "magnet:") {
+				item.Link = link
+				break
+			}
+			if item.Link == "" {
+				item.Link = link
+			}
+		}
+		items = append(items, item)
+	}
+
+	for _, e := range doc.Entries {
+		item := FeedItem{Title: strings.TrimSpace(e.Title), GUID: strings.TrimSpace(e.ID)}
+		for _, link := range e.Links {
+			switch {
+			case strings.HasPrefix(link.Href, "magnet:"):
+				item.Link = link.Href
+			case link.Rel == "enclosure" && !strings.HasPrefix(item.Link, "magnet:"):
+				item.Link = link.Href
+			case item.Link == "":
+				item.Link = link.Href
+			}
+		}
+		items = append(items, item)
+	}
+
+	for i := range items {
+		if items[i].GUID == "" {
+			items[i].GUID = items[i].Link
+		}
+	}
+	return items, nil
+}
+
+func fetchFeed(url string) ([]FeedItem, error) {
+	client := http.Client{Timeout: feedTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch feed: %s", resp.Status)
+	}
+	return parseFeed(io.LimitReader(resp.Body, maxFeedSize))
+}
+
+func (m *Model) LoadFeeds() ([]Feed, error) {
+	rows, err := m.DB.Query(`
+        SELECT id, url, name, include, exclude, download_dir, label, last_checked, last_error
+        FROM feeds ORDER BY id
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feeds []Feed
+	for rows.Next() {
+		var f Feed
+		var lastChecked sql.NullTime
+		if err := rows.Scan(&f.ID, &f.URL, &f.Name, &f.Include, &f.Exclude, &f.DownloadDir, &f.Label, &lastChecked, &f.LastError); err != nil {
+			return nil, err
+		}
+		f.LastChecked = lastChecked.Time
+		feeds = append(feeds, f)
+	}
+	return feeds, rows.Err()
+}
+
+// SaveFeed adds a new feed, or updates it if it has an ID.
+func (m *Model) SaveFeed(f *Feed) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	if f.ID != 0 {
+		_, err := m.DB.Exec(`
+            UPDATE feeds SET url = ?, name = ?, include = ?, exclude = ?, download_dir = ?, label = ?
+            WHERE id = ?
+        `, f.URL, f.Name, f.Include, f.Exclude, f.DownloadDir, f.Label, f.ID)
+		if err != nil {
+			return fmt.Errorf("failed to save feed: %v", err)
+		}
+		return nil
+	}
+
+	res, err := m.DB.Exec(`
+        INSERT INTO feeds (url, name, include, exclude, download_dir, label)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `, f.URL, f.Name, f.Include, f.Exclude, f.DownloadDir, f.Label)
+	if err != nil {
+		return fmt.Errorf("failed to save feed: %v", err)
+	}
+	f.ID, err = res.LastInsertId()
+	return err
+}
+
+func (m *Model) DeleteFeed(id int64) error {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	if _, err := m.DB.Exec("DELETE FROM feeds WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete feed: %v", err)
+	}
+	return nil
+}
+
+// seenFeedItem reports whether an item, or another release of the same
+// episode, was added before from any feed.
+func (m *Model) seenFeedItem(item FeedItem) (bool, error) {
+	var n int
+	err := m.DB.QueryRow(`
+        SELECT COUNT(*) FROM feed_history
+        WHERE guid = ? OR (episode != '' AND episode = ?)
+    `, item.GUID, episodeKey(item.Title)).Scan(&n)
+	return n > 0, err
+}
+
+func (m *Model) recordFeedItem(feedID int64, item FeedItem) error {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	_, err := m.DB.Exec(`
+        INSERT OR IGNORE INTO feed_history (guid, feed_id, title, episode)
+        VALUES (?, ?, ?, ?)
+    `, item.GUID, feedID, item.Title, episodeKey(item.Title))
+	return err
+}
+
+func (m *Model) markFeedChecked(f Feed, checkErr error) {
+	lastError := ""
+	if checkErr != nil {
+		lastError = checkErr.Error()
+	}
+
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+	m.DB.Exec("UPDATE feeds SET last_checked = ?, last_error = ? WHERE id = ?", time.Now(), lastError, f.ID)
+}
+
+// classifyFeedItems decides for every item whether a check would add it.
+func (m *Model) classifyFeedItems(f Feed, items []FeedItem) ([]FeedMatch, error) {
+	matches := make([]FeedMatch, 0, len(items))
+	for _, item := range items {
+		status := FeedItemFiltered
+		if f.Matches(item.Title) {
+			seen, err := m.seenFeedItem(item)
+			if err != nil {
+				return nil, err
+			}
+			status = FeedItemMatch
+			if seen {
+				status = FeedItemSeen
+			}
+		}
+		matches = append(matches, FeedMatch{Item: item, Status: status})
+	}
+	return matches, nil
+}
+
+// PreviewFeed fetches a feed and shows what checking it would add, without
+// adding anything.
+func (m *Model) PreviewFeed(f Feed) ([]FeedMatch, error) {
+	items, err := fetchFeed(f.URL)
+	if err != nil {
+		return nil, err
+	}
+	return m.classifyFeedItems(f, items)
+}
+
+// CheckFeed fetches a feed and adds the items that match its filters and
+// weren't added before, returning how many were added.
+func (m *Model) CheckFeed(f Feed) (int, error) {
+	added, err := m.checkFeed(f)
+	m.markFeedChecked(f, err)
+	return added, err
+}
+
+func (m *Model) checkFeed(f Feed) (int, error) {
+	items, err := fetchFeed(f.URL)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	var addErr error
+	for _, item := range items {
+		// Classify one item at a time, as adding one makes other releases
+		// of the same episode seen.
+		matches, err := m.classifyFeedItems(f, []FeedItem{item})
+		if err != nil {
+			return added, err
+		}
+		if matches[0].Status != FeedItemMatch || item.Link == "" {
+			continue
+		}
+
+		// An item that can't be added, e.g. for a dead link, is tried again
+		// on the next check, without holding up the items after it.
+		if _, _, err := m.AddURL(item.Link, AddOptions{SavePath: f.DownloadDir, Label: f.Label}); err != nil {
+			err = fmt.Errorf("failed to add %s: %v", item.Title, err)
+			// Feeds are checked in the background, alongside View.
+			m.Mu.Lock()
+			m.Err = err
+			m.Mu.Unlock()
+			if addErr == nil {
+				addErr = err
+			}
+			continue
+		}
+		if err := m.recordFeedItem(f.ID, item); err != nil {
+			return added, err
+		}
+		added++
+	}
+	return added, addErr
+}
+
+// startFeeds checks feeds in the background, each once the configured feed
+// interval has passed since its last check.
+func (m *Model) startFeeds() {
+	m.feedStop = make(chan struct{})
+	m.feedWG.Add(1)
+
+	go func() {
+		defer m.feedWG.Done()
+
+		ticker := time.NewTicker(feedCheckInterval)
+		defer ticker.Stop()
+		for {
+			m.checkDueFeeds()
+			select {
+			case <-m.feedStop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (m *Model) stopFeeds() {
+	if m.feedStop != nil {
+		close(m.feedStop)
+		m.feedWG.Wait()
+	}
+}
+
+func (m *Model) checkDueFeeds() {
+	interval := time.Duration(m.ConfigSnapshot().FeedInterval) * time.Minute
+	if interval <= 0 {
+		return
+	}
+
+	feeds, err := m.LoadFeeds()
+	if err != nil {
+		m.Mu.Lock()
+		m.Err = err
+		m.Mu.Unlock()
+		return
+	}
+	for _, f := range feeds {
+		if time.Since(f.LastChecked) < interval {
+			continue
+		}
+		if added, _ := m.CheckFeed(f); added > 0 {
+			m.Mu.Lock()
+			m.Notice = fmt.Sprintf("Added %d torrents from %s", added, f.Name)
+			m.Mu.Unlock()
+		}
+	}
+}
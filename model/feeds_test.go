@@ -0,0 +1,324 @@
+package model
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestFetchFeedRSS(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer srv.Close()
+
+	items, err := fetchFeed(srv.URL + "/feed.rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FeedItem{
+		{Title: "Show Name S01E01 720p", GUID: "item-1", Link: "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567"},
+		{Title: "Show Name S01E02 720p", GUID: "item-2", Link: "https://example.com/download/2.torrent"},
+		{Title: "Show.Name.1x03.HDTV", GUID: "https://example.com/download/3.torrent", Link: "https://example.com/download/3.torrent"},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got items %+v, want %+v", items, want)
+	}
+}
+
+func TestFetchFeedAtom(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer srv.Close()
+
+	items, err := fetchFeed(srv.URL + "/feed.atom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FeedItem{
+		{Title: "Show Name S02E01 1080p", GUID: "urn:example:entry-1", Link: "https://example.com/download/1.torrent"},
+		{Title: "Show Name S02E02 1080p", GUID: "urn:example:entry-2", Link: "magnet:?xt=urn:btih:89abcdef0123456789abcdef0123456789abcdef"},
+		{Title: "Another Show", GUID: "https://example.com/download/3.torrent", Link: "https://example.com/download/3.torrent"},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got items %+v, want %+v", items, want)
+	}
+}
+
+func TestFetchFeedErrors(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer srv.Close()
+
+	if _, err := fetchFeed(srv.URL + "/missing.rss"); err == nil {
+		t.Error("expected an error for a missing feed")
+	}
+
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<rss><channel><item>")
+	}))
+	defer bad.Close()
+	if _, err := fetchFeed(bad.URL); err == nil {
+		t.Error("expected an error for a truncated feed")
+	}
+}
+
+func TestFeedMatches(t *testing.T) {
+	tests := []struct {
+		include, exclude string
+		title            string
+		want             bool
+	}{
+		{"", "", "Anything", true},
+		{"show name", "", "Show.Name.S01E01", false},
+		{`show[ .]name`, "", "Show.Name.S01E01", true},
+		{`show[ .]name`, "", "Other Show S01E01", false},
+		{"", "720p", "Show Name S01E01 720p", false},
+		{"", "720p", "Show Name S01E01 1080p", true},
+		{"show", "720p|hdtv", "Show Name S01E01 HDTV", false},
+		{"show", "720p|hdtv", "Show Name S01E01 1080p", true},
+		{"(", "", "Show", false},
+	}
+	for _, tt := range tests {
+		f := Feed{Include: tt.include, Exclude: tt.exclude}
+		if got := f.Matches(tt.title); got != tt.want {
+			t.Errorf("include %q exclude %q: Matches(%q) = %v, want %v", tt.include, tt.exclude, tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestEpisodeKey(t *testing.T) {
+	tests := []struct {
+		title, want string
+	}{
+		{"Show Name S01E02 720p", "show name s01e02"},
+		{"Show.Name.s1e2.1080p", "show name s01e02"},
+		{"show_name - S01E02", "show name s01e02"},
+		{"Show Name 1x02 HDTV", "show name s01e02"},
+		{"Show Name S01E03", "show name s01e03"},
+		{"Some Movie 2024 1080p", ""},
+	}
+	for _, tt := range tests {
+		if got := episodeKey(tt.title); got != tt.want {
+			t.Errorf("episodeKey(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+// newFeedTestModel returns a model with a database and a torrent client, both
+// in temporary directories, that doesn't reach out to the network.
+func newFeedTestModel(t *testing.T) *Model {
+	t.Helper()
+
+	dir := t.TempDir()
+	// Added torrents are saved in the background, concurrently with checks.
+	db, err := sql.Open("sqlite", filepath.Join(dir, "rapidtorrent.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := initDatabase(db); err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+
+	m := &Model{Torrents: make(map[string]*TorrentItem), DB: db}
+	m.Config.DownloadDir = filepath.Join(dir, "downloads")
+	m.DownloadLimiter = newRateLimiter(0, downloadBurst)
+	m.UploadLimiter = newRateLimiter(0, uploadBurst)
+
+	cfg := m.newClientConfig()
+	cfg.ListenPort = 0
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	cfg.DisableIPv6 = true
+	m.Client, err = torrent.NewClient(cfg)
+	if err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		m.Client.Close()
+		m.closeStorages()
+		db.Close()
+	})
+	return m
+}
+
+// testTorrent returns a .torrent file for a file with the given content.
+func testTorrent(t *testing.T, name, content string) []byte {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info := metainfo.Info{PieceLength: 16 << 10}
+	if err := info.BuildFromFilePath(path); err != nil {
+		t.Fatal(err)
+	}
+	mi := metainfo.MetaInfo{}
+	var err error
+	if mi.InfoBytes, err = bencode.Marshal(info); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// torrentNames returns the sorted names of the torrents of m once they are
+// past connecting, i.e. awaitInfo is done with them.
+func torrentNames(t *testing.T, m *Model) []string {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		m.Mu.RLock()
+		var names []string
+		settled := true
+		for _, item := range m.Torrents {
+			names = append(names, item.Name)
+			settled = settled && item.State != "connecting"
+		}
+		m.Mu.RUnlock()
+
+		if settled || time.Now().After(deadline) {
+			sort.Strings(names)
+			return names
+		}
+	}
+}
+
+func TestCheckFeed(t *testing.T) {
+	m := newFeedTestModel(t)
+
+	torrents := map[string][]byte{
+		"/e01-1080p.torrent":  testTorrent(t, "e01-1080p.bin", "episode 1"),
+		"/e02.torrent":        testTorrent(t, "e02.bin", "episode 2"),
+		"/e02-repack.torrent": testTorrent(t, "e02-repack.bin", "episode 2 repack"),
+		"/other.torrent":      testTorrent(t, "other.bin", "other show"),
+	}
+	var feed string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/feed.rss" {
+			fmt.Fprint(w, feed)
+			return
+		}
+		data, ok := torrents[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	item := func(title, path string) string {
+		return fmt.Sprintf("<item><title>%s</title><guid>%s</guid><link>%s%s</link></item>", title, path, srv.URL, path)
+	}
+	feed = "<rss><channel>" + strings.Join([]string{
+		item("Show Name S01E01 720p", "/e01-720p.torrent"),
+		item("Show Name S01E01 1080p", "/e01-1080p.torrent"),
+		item("Show Name S01E02 1080p", "/e02.torrent"),
+		// Another release of an episode that was just added.
+		item("Show Name S01E02 1080p REPACK", "/e02-repack.torrent"),
+		item("Other Show S01E01 1080p", "/other.torrent"),
+		item("Show Name S01E03 720p", "/e03-720p.torrent"),
+	}, "") + "</channel></rss>"
+
+	f := Feed{URL: srv.URL + "/feed.rss", Name: "Test", Include: "^show name", Exclude: "720p"}
+	if err := m.SaveFeed(&f); err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := m.CheckFeed(f)
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if added != 2 {
+		t.Errorf("added %d torrents, want 2", added)
+	}
+	names := torrentNames(t, m)
+	if want := []string{"e01-1080p.bin", "e02.bin"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got torrents %v, want %v", names, want)
+	}
+
+	// Every episode is seen now, so nothing is added again.
+	if added, err := m.CheckFeed(f); err != nil || added != 0 {
+		t.Errorf("second check added %d torrents with error %v, want 0", added, err)
+	}
+
+	matches, err := m.PreviewFeed(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []string
+	for _, match := range matches {
+		statuses = append(statuses, match.Status)
+	}
+	want := []string{FeedItemFiltered, FeedItemSeen, FeedItemSeen, FeedItemSeen, FeedItemFiltered, FeedItemFiltered}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("got statuses %v, want %v", statuses, want)
+	}
+}
+
+func TestCheckFeedSkipsFailedItems(t *testing.T) {
+	m := newFeedTestModel(t)
+
+	second := testTorrent(t, "second.bin", "second")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.rss":
+			fmt.Fprintf(w, `<rss><channel>
+				<item><title>First</title><link>%[1]s/dead.torrent</link></item>
+				<item><title>Second</title><link>%[1]s/second.torrent</link></item>
+			</channel></rss>`, "http://"+r.Host)
+		case "/second.torrent":
+			w.Write(second)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	f := Feed{URL: srv.URL + "/feed.rss", Name: "Test"}
+	if err := m.SaveFeed(&f); err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := m.CheckFeed(f)
+	if err == nil || !strings.Contains(err.Error(), "First") {
+		t.Errorf("got error %v, want one for the dead item", err)
+	}
+	if added != 1 {
+		t.Errorf("added %d torrents, want 1", added)
+	}
+
+	feeds, err := m.LoadFeeds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || !strings.Contains(feeds[0].LastError, "First") {
+		t.Errorf("got feeds %+v, want the error recorded", feeds)
+	}
+
+	// The dead item isn't recorded, so it's tried again.
+	matches, err := m.PreviewFeed(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matches[0].Status != FeedItemMatch || matches[1].Status != FeedItemSeen {
+		t.Errorf("got matches %+v, want the dead item still matching", matches)
+	}
+}
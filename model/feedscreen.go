@@ -0,0 +1,345 @@
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Inputs of the feed form, in the order they are shown.
+const (
+	feedInputURL = iota
+	feedInputName
+	feedInputInclude
+	feedInputExclude
+	feedInputDownloadDir
+	feedInputLabel
+)
+
+// feedPreviewMsg carries the result of fetching a feed for the preview.
+type feedPreviewMsg struct {
+	matches []FeedMatch
+	err     error
+}
+
+// feedCheckedMsg is sent when checking a feed from the feed screen is done.
+type feedCheckedMsg struct {
+	name  string
+	added int
+	err   error
+}
+
+// openFeeds shows the feed screen.
+func (m *Model) openFeeds() {
+	feeds, err := m.LoadFeeds()
+	if err != nil {
+		m.Err = err
+		return
+	}
+	m.ShowFeeds = true
+	m.Feeds = feeds
+	m.FeedInputs = nil
+	m.ShowFeedPreview = false
+	m.clampFeedCursor()
+}
+
+func (m *Model) reloadFeeds() {
+	feeds, err := m.LoadFeeds()
+	if err != nil {
+		m.Err = err
+		return
+	}
+	m.Feeds = feeds
+	m.clampFeedCursor()
+}
+
+func (m *Model) clampFeedCursor() {
+	if m.FeedCursor >= len(m.Feeds) {
+		m.FeedCursor = len(m.Feeds) - 1
+	}
+	if m.FeedCursor < 0 {
+		m.FeedCursor = 0
+	}
+}
+
+func (m *Model) selectedFeed() (Feed, bool) {
+	if m.FeedCursor < 0 || m.FeedCursor >= len(m.Feeds) {
+		return Feed{}, false
+	}
+	return m.Feeds[m.FeedCursor], true
+}
+
+// openFeedForm shows the form for editing f, or for a new feed if f has no ID.
+func (m *Model) openFeedForm(f Feed) {
+	m.FeedEditID = f.ID
+	m.FeedInputs = []textinput.Model{
+		newConfigInput("Feed URL", "Enter RSS or Atom feed URL", f.URL),
+		newConfigInput("Name", "Defaults to the feed host", f.Name),
+		newConfigInput("Include (regex)", "Empty matches everything", f.Include),
+		newConfigInput("Exclude (regex)", "Empty excludes nothing", f.Exclude),
+		newConfigInput("Download Directory", "Empty for the default", f.DownloadDir),
+		newConfigInput("Label", "Enter label", f.Label),
+	}
+	m.FeedInputs[feedInputURL].Focus()
+}
+
+func (m *Model) saveFeedForm() {
+	f := Feed{
+		ID:          m.FeedEditID,
+		URL:         strings.TrimSpace(m.FeedInputs[feedInputURL].Value()),
+		Name:        strings.TrimSpace(m.FeedInputs[feedInputName].Value()),
+		Include:     m.FeedInputs[feedInputInclude].Value(),
+		Exclude:     m.FeedInputs[feedInputExclude].Value(),
+		DownloadDir: strings.TrimSpace(m.FeedInputs[feedInputDownloadDir].Value()),
+		Label:       strings.TrimSpace(m.FeedInputs[feedInputLabel].Value()),
+	}
+	if f.Name == "" {
+		if u, err := url.Parse(f.URL); err == nil {
+			f.Name = u.Host
+		}
+	}
+
+	if err := m.SaveFeed(&f); err != nil {
+		m.Err = err
+		return
+	}
+	m.Err = nil
+	m.FeedInputs = nil
+	m.reloadFeeds()
+	for i, feed := range m.Feeds {
+		if feed.ID == f.ID {
+			m.FeedCursor = i
+		}
+	}
+}
+
+func (m *Model) updateFeeds(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.String() == "ctrl+c" {
+		return m, tea.Quit
+	}
+
+	if m.FeedInputs != nil {
+		return m.updateFeedForm(msg)
+	}
+
+	if m.ShowFeedPreview {
+		if msg.String() == "esc" {
+			m.ShowFeedPreview = false
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.Viewport, cmd = m.Viewport.Update(msg)
+		return m, cmd
+	}
+
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "esc":
+		m.ShowFeeds = false
+	case "up":
+		m.FeedCursor--
+		m.clampFeedCursor()
+	case "down":
+		m.FeedCursor++
+		m.clampFeedCursor()
+	case "a":
+		m.openFeedForm(Feed{})
+	case "e":
+		if f, ok := m.selectedFeed(); ok {
+			m.openFeedForm(f)
+		}
+	case "d":
+		if f, ok := m.selectedFeed(); ok {
+			if err := m.DeleteFeed(f.ID); err != nil {
+				m.Err = err
+			}
+			m.reloadFeeds()
+		}
+	case "enter":
+		if f, ok := m.selectedFeed(); ok {
+			m.ShowFeedPreview = true
+			m.FeedPreview = nil
+			m.Viewport.GotoTop()
+			return m, func() tea.Msg {
+				matches, err := m.PreviewFeed(f)
+				return feedPreviewMsg{matches: matches, err: err}
+			}
+		}
+	case "u":
+		if f, ok := m.selectedFeed(); ok {
+			m.Notice = "Checking " + f.Name + "..."
+			return m, func() tea.Msg {
+				added, err := m.CheckFeed(f)
+				return feedCheckedMsg{name: f.Name, added: added, err: err}
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m *Model) updateFeedForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.FeedInputs = nil
+		m.Err = nil
+		return m, nil
+	case "enter":
+		m.saveFeedForm()
+		return m, nil
+	case "tab", "shift+tab":
+		for i := range m.FeedInputs {
+			if m.FeedInputs[i].Focused() {
+				m.FeedInputs[i].Blur()
+				next := (i + 1) % len(m.FeedInputs)
+				if msg.String() == "shift+tab" {
+					next = (i + len(m.FeedInputs) - 1) % len(m.FeedInputs)
+				}
+				m.FeedInputs[next].Focus()
+				break
+			}
+		}
+		return m, nil
+	}
+
+	var cmds []tea.Cmd
+	for i := range m.FeedInputs {
+		var cmd tea.Cmd
+		m.FeedInputs[i], cmd = m.FeedInputs[i].Update(msg)
+		cmds = append(cmds, cmd)
+	}
+	return m, tea.Batch(cmds...)
+}
+
+func (m *Model) handleFeedMsg(msg tea.Msg) {
+	switch msg := msg.(type) {
+	case feedPreviewMsg:
+		if msg.err != nil {
+			m.Err = msg.err
+			m.ShowFeedPreview = false
+			return
+		}
+		m.Err = nil
+		m.FeedPreview = msg.matches
+	case feedCheckedMsg:
+		if msg.err != nil {
+			m.Err = msg.err
+			m.Notice = ""
+		} else {
+			m.Err = nil
+			m.Notice = fmt.Sprintf("Added %d torrents from %s", msg.added, msg.name)
+		}
+		if m.ShowFeeds {
+			m.reloadFeeds()
+		}
+	}
+}
+
+func (m *Model) feedsView() string {
+	var s strings.Builder
+
+	if m.FeedInputs != nil {
+		title := "Add Feed"
+		if m.FeedEditID != 0 {
+			title = "Edit Feed"
+		}
+		s.WriteString(titleStyle.Render(title))
+		s.WriteString("\n\n")
+		for _, input := range m.FeedInputs {
+			s.WriteString(input.View())
+			s.WriteString("\n")
+		}
+		s.WriteString("\nPress Enter to save, Tab to switch fields, Esc to cancel")
+		return s.String()
+	}
+
+	if m.ShowFeedPreview {
+		f, _ := m.selectedFeed()
+		s.WriteString(titleStyle.Render("Preview: " + f.Name))
+		s.WriteString("\n\n")
+		m.Viewport.SetContent(feedPreviewView(m.FeedPreview))
+		s.WriteString(m.Viewport.View())
+		s.WriteString("\n\nEsc to go back")
+		return s.String()
+	}
+
+	s.WriteString(titleStyle.Render("Feeds"))
+	s.WriteString("\n\n")
+	var content strings.Builder
+	if len(m.Feeds) == 0 {
+		content.WriteString("No feeds yet, press 'a' to add one\n")
+	}
+	for i, f := range m.Feeds {
+		line := fmt.Sprintf("  %s (%s)", f.Name, f.URL)
+		if i == m.FeedCursor {
+			line = selectedStyle.Render(fmt.Sprintf("> %s (%s)", f.Name, f.URL))
+		}
+		content.WriteString(line + "\n")
+
+		details := "    Include: " + orAny(f.Include) + " • Exclude: " + orNone(f.Exclude)
+		if f.Label != "" {
+			details += " • Label: " + f.Label
+		}
+		content.WriteString(details + "\n")
+
+		checked := "    Never checked"
+		if !f.LastChecked.IsZero() {
+			checked = "    Checked " + f.LastChecked.Local().Format(time.DateTime)
+		}
+		if f.LastError != "" {
+			checked += " • Error: " + f.LastError
+		}
+		content.WriteString(checked + "\n")
+	}
+	m.Viewport.SetContent(content.String())
+	m.scrollToLine(m.FeedCursor*3, 3)
+	s.WriteString(m.Viewport.View())
+
+	interval := "off"
+	if minutes := m.ConfigSnapshot().FeedInterval; minutes > 0 {
+		interval = fmt.Sprintf("every %d min", minutes)
+	}
+	s.WriteString(fmt.Sprintf("\n\nChecking %s • 'a' add • 'e' edit • 'd' delete • Enter preview • 'u' check now • Esc to go back", interval))
+	return s.String()
+}
+
+func feedPreviewView(matches []FeedMatch) string {
+	if matches == nil {
+		return "Fetching feed..."
+	}
+	if len(matches) == 0 {
+		return "The feed has no items"
+	}
+
+	var s strings.Builder
+	for _, match := range matches {
+		switch match.Status {
+		case FeedItemMatch:
+			s.WriteString(selectedStyle.Render("+ " + match.Item.Title))
+		case FeedItemSeen:
+			s.WriteString("= " + match.Item.Title + " (already added)")
+		default:
+			s.WriteString("  " + match.Item.Title)
+		}
+		s.WriteString("\n")
+	}
+	return s.String()
+}
+
+func orAny(pattern string) string {
+	if pattern == "" {
+		return "anything"
+	}
+	return pattern
+}
+
+func orNone(pattern string) string {
+	if pattern == "" {
+		return "nothing"
+	}
+	return pattern
+}
@@ -0,0 +1,244 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+)
+
+// File priorities as stored in the torrent_files table.
+const (
+	FilePrioritySkip   = "skip"
+	FilePriorityNormal = "normal"
+	FilePriorityHigh   = "high"
+)
+
+var filePiecePriorities = map[string]torrent.PiecePriority{
+	FilePrioritySkip:   torrent.PiecePriorityNone,
+	FilePriorityNormal: torrent.PiecePriorityNormal,
+	FilePriorityHigh:   torrent.PiecePriorityHigh,
+}
+
+// FilePriorityName returns the name of the file priority closest to prio.
+func FilePriorityName(prio torrent.PiecePriority) string {
+	switch {
+	case prio == torrent.PiecePriorityNone:
+		return FilePrioritySkip
+	case prio >= torrent.PiecePriorityHigh:
+		return FilePriorityHigh
+	default:
+		return FilePriorityNormal
+	}
+}
+
+// applyFilePriorities starts downloading the files of a torrent, honoring the
+// priorities chosen in earlier sessions. Files without a saved priority are
+// downloaded normally.
+func (m *Model) applyFilePriorities(infoHash string, t *torrent.Torrent) error {
+	priorities, err := m.LoadFilePriorities(infoHash)
+	if err != nil {
+		t.DownloadAll()
+		return err
+	}
+
+	for i, f := range t.Files() {
+		prio, ok := filePiecePriorities[priorities[i]]
+		if !ok {
+			prio = torrent.PiecePriorityNormal
+		}
+		f.SetPriority(prio)
+	}
+	return nil
+}
+
+// SetFilePriority changes the priority of a single file of a torrent and
+// remembers it for later sessions.
+func (m *Model) SetFilePriority(infoHash string, index int, priority string) error {
+	prio, ok := filePiecePriorities[priority]
+	if !ok {
+		return fmt.Errorf("unknown file priority %q", priority)
+	}
+
+	m.Mu.RLock()
+	item, exists := m.Torrents[infoHash]
+	m.Mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("torrent %s not found", infoHash)
+	}
+	if item.Torrent.Info() == nil {
+		return fmt.Errorf("torrent %s has no metadata yet", infoHash)
+	}
+
+	files := item.Torrent.Files()
+	if index < 0 || index >= len(files) {
+		return fmt.Errorf("torrent %s has no file %d", infoHash, index)
+	}
+	files[index].SetPriority(prio)
+
+	return m.SaveFilePriority(infoHash, index, priority)
+}
+
+// downloadComplete reports whether every file selected for download is
+// complete, which is when a torrent with skipped files starts seeding.
+func downloadComplete(t *torrent.Torrent) bool {
+	if t.Info() == nil {
+		return false
+	}
+	for _, f := range t.Files() {
+		if f.Priority() != torrent.PiecePriorityNone && f.BytesCompleted() < f.Length() {
+			return false
+		}
+	}
+	return true
+}
+
+// fileRow is a line of the file tree on the files tab: a directory, or a
+// file of the torrent.
+type fileRow struct {
+	name  string
+	depth int
+	// dir is the path of a directory row, empty for a file.
+	dir string
+	// files are the indexes of the file of the row, or of every file below
+	// the directory.
+	files []int
+}
+
+func (r fileRow) isDir() bool {
+	return r.dir != ""
+}
+
+// fileRows lays the files of a torrent out as a tree, in the order of the
+// torrent, leaving out what is below collapsed directories.
+func (m *Model) fileRows(files []*torrent.File) []fileRow {
+	type node struct {
+		row      fileRow
+		children []*node
+	}
+	root := &node{}
+	dirs := make(map[string]*node)
+
+	for i, f := range files {
+		parts := strings.Split(f.DisplayPath(), "/")
+		parent := root
+		for depth, name := range parts[:len(parts)-1] {
+			dir := strings.Join(parts[:depth+1], "/")
+			n, ok := dirs[dir]
+			if !ok {
+				n = &node{row: fileRow{name: name, depth: depth, dir: dir}}
+				dirs[dir] = n
+				parent.children = append(parent.children, n)
+			}
+			n.row.files = append(n.row.files, i)
+			parent = n
+		}
+		parent.children = append(parent.children, &node{row: fileRow{name: parts[len(parts)-1], depth: len(parts) - 1, files: []int{i}}})
+	}
+
+	var rows []fileRow
+	var walk func(n *node)
+	walk = func(n *node) {
+		for _, child := range n.children {
+			rows = append(rows, child.row)
+			if child.row.isDir() && !m.collapsedDirs[child.row.dir] {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+	return rows
+}
+
+// selectedFile returns the index of the file under the cursor of the files
+// tab, or -1 if the cursor is on a directory.
+func (m *Model) selectedFile(files []*torrent.File) int {
+	rows := m.fileRows(files)
+	if m.FileCursor >= len(rows) || rows[m.FileCursor].isDir() {
+		return -1
+	}
+	return rows[m.FileCursor].files[0]
+}
+
+// handleFileKey applies a key pressed on the files tab of the detail pane.
+// Priorities set on a directory apply to every file below it.
+func (m *Model) handleFileKey(key string, files []*torrent.File) {
+	rows := m.fileRows(files)
+	if m.FileCursor >= len(rows) {
+		m.FileCursor = max(len(rows)-1, 0)
+	}
+	if len(rows) == 0 {
+		return
+	}
+	row := rows[m.FileCursor]
+
+	switch key {
+	case "up":
+		if m.FileCursor > 0 {
+			m.FileCursor--
+		}
+	case "down":
+		if m.FileCursor < len(rows)-1 {
+			m.FileCursor++
+		}
+	case "enter":
+		if row.isDir() {
+			m.setCollapsed(row.dir, !m.collapsedDirs[row.dir])
+		}
+	case "right":
+		if row.isDir() {
+			m.setCollapsed(row.dir, false)
+		}
+	case "left":
+		if row.isDir() && !m.collapsedDirs[row.dir] {
+			m.setCollapsed(row.dir, true)
+			return
+		}
+		// Anywhere else, left goes up to the parent directory.
+		for i := m.FileCursor - 1; i >= 0; i-- {
+			if rows[i].isDir() && rows[i].depth < row.depth {
+				m.FileCursor = i
+				return
+			}
+		}
+	case " ", "s", "n", "h":
+		priority := map[string]string{
+			"s": FilePrioritySkip,
+			"n": FilePriorityNormal,
+			"h": FilePriorityHigh,
+		}[key]
+		if priority == "" {
+			// Space toggles between skipping and downloading the files,
+			// downloading them all unless every one is downloaded.
+			priority = FilePriorityNormal
+			if filesSelected(files, row.files) == len(row.files) {
+				priority = FilePrioritySkip
+			}
+		}
+		for _, i := range row.files {
+			if err := m.SetFilePriority(m.DetailHash, i, priority); err != nil {
+				m.Err = err
+				return
+			}
+		}
+	}
+}
+
+func (m *Model) setCollapsed(dir string, collapsed bool) {
+	if m.collapsedDirs == nil {
+		m.collapsedDirs = make(map[string]bool)
+	}
+	m.collapsedDirs[dir] = collapsed
+}
+
+// filesSelected returns how many of the given files are downloaded rather
+// than skipped.
+func filesSelected(files []*torrent.File, indexes []int) int {
+	n := 0
+	for _, i := range indexes {
+		if files[i].Priority() != torrent.PiecePriorityNone {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,217 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"main/utils"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	infohash_v2 "github.com/anacrolix/torrent/types/infohash-v2"
+)
+
+// metadataTimeout is how long inspecting a magnet link waits for peers to
+// send its metadata.
+const metadataTimeout = time.Minute
+
+// TorrentSummary describes what a torrent holds.
+type TorrentSummary struct {
+	Name        string        `json:"name"`
+	InfoHash    string        `json:"info_hash,omitempty"`
+	InfoHashV2  string        `json:"info_hash_v2,omitempty"`
+	TotalSize   int64         `json:"total_size"`
+	PieceLength int64         `json:"piece_length"`
+	Pieces      int           `json:"pieces"`
+	Private     bool          `json:"private"`
+	Comment     string        `json:"comment,omitempty"`
+	Trackers    [][]string    `json:"trackers"`
+	WebSeeds    []string      `json:"web_seeds"`
+	Files       []SummaryFile `json:"files"`
+}
+
+type SummaryFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Summarize describes the torrent of mi.
+func Summarize(mi *metainfo.MetaInfo) (TorrentSummary, error) {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return TorrentSummary{}, fmt.Errorf("invalid metainfo: %v", err)
+	}
+
+	s := TorrentSummary{
+		Name:        info.BestName(),
+		PieceLength: info.PieceLength,
+		Pieces:      info.NumPieces(),
+		Private:     info.Private != nil && *info.Private,
+		Comment:     mi.Comment,
+		Trackers:    mi.UpvertedAnnounceList(),
+		WebSeeds:    mi.UrlList,
+		Files:       []SummaryFile{},
+	}
+	if info.HasV1() {
+		s.InfoHash = mi.HashInfoBytes().HexString()
+	}
+	if info.HasV2() {
+		v2 := infohash_v2.HashBytes(mi.InfoBytes)
+		s.InfoHashV2 = v2.HexString()
+	}
+	if s.Trackers == nil {
+		s.Trackers = [][]string{}
+	}
+	if s.WebSeeds == nil {
+		s.WebSeeds = []string{}
+	}
+
+	for _, fi := range info.UpvertedFiles() {
+		// Pad files only align the files of hybrid torrents to pieces.
+		if strings.Contains(fi.Attr, "p") {
+			continue
+		}
+		s.Files = append(s.Files, SummaryFile{Path: fi.DisplayPath(&info), Size: fi.Length})
+		s.TotalSize += fi.Length
+	}
+	return s, nil
+}
+
+// Text formats the summary for reading in a terminal.
+func (s TorrentSummary) Text() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", s.Name)
+	if s.InfoHash != "" {
+		fmt.Fprintf(w, "Info hash:\t%s\n", s.InfoHash)
+	}
+	if s.InfoHashV2 != "" {
+		fmt.Fprintf(w, "Info hash v2:\t%s\n", s.InfoHashV2)
+	}
+	fmt.Fprintf(w, "Size:\t%s in %d files\n", utils.FormatBytes(s.TotalSize), len(s.Files))
+	fmt.Fprintf(w, "Pieces:\t%d of %s\n", s.Pieces, utils.FormatBytes(s.PieceLength))
+	private := "no"
+	if s.Private {
+		private = "yes"
+	}
+	fmt.Fprintf(w, "Private:\t%s\n", private)
+	if s.Comment != "" {
+		fmt.Fprintf(w, "Comment:\t%s\n", s.Comment)
+	}
+	for i, tier := range s.Trackers {
+		label := ""
+		if i == 0 {
+			label = "Trackers:"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", label, strings.Join(tier, " "))
+	}
+	for i, url := range s.WebSeeds {
+		label := ""
+		if i == 0 {
+			label = "Web seeds:"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", label, url)
+	}
+	w.Flush()
+
+	b.WriteString("\nFiles:\n")
+	w = tabwriter.NewWriter(&b, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, f := range s.Files {
+		fmt.Fprintf(w, "  %s\t  %s\n", utils.FormatBytes(f.Size), f.Path)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// LoadMetainfo reads a .torrent file.
+func LoadMetainfo(path string) (*metainfo.MetaInfo, error) {
+	mi, err := metainfo.LoadFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return mi, nil
+}
+
+// FetchMetainfo gets the metadata of a magnet link from peers with a client
+// of its own, which downloads nothing else and is gone afterwards.
+func FetchMetainfo(magnetURI string, timeout time.Duration) (*metainfo.MetaInfo, error) {
+	dir, err := os.MkdirTemp("", "rapidtorrent-inspect")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = dir
+	cfg.ListenPort = 0
+	cfg.NoUpload = true
+	// Errors of peers, trackers and the DHT don't matter for this.
+	cfg.Logger = log.Default.WithFilterLevel(log.Disabled)
+	client, err := torrent.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start client: %v", err)
+	}
+	defer client.Close()
+
+	return fetchMetainfo(client, magnetURI, timeout, func() bool { return true })
+}
+
+// FetchMetainfo gets the metadata of a magnet link using the client of the
+// session, without adding the torrent to it.
+func (m *Model) FetchMetainfo(magnetURI string) (*metainfo.MetaInfo, error) {
+	spec, err := magnetSpec(magnetURI)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Mu.RLock()
+	item, exists := m.Torrents[spec.InfoHash.HexString()]
+	m.Mu.RUnlock()
+	if exists && item.Torrent.Info() != nil {
+		mi := item.Torrent.Metainfo()
+		mi.Comment, mi.CreatedBy = "", ""
+		return &mi, nil
+	}
+
+	return fetchMetainfo(m.Client, magnetURI, metadataTimeout, func() bool {
+		// The torrent may have been added to the session in the meantime.
+		m.Mu.RLock()
+		defer m.Mu.RUnlock()
+		_, exists := m.Torrents[spec.InfoHash.HexString()]
+		return !exists
+	})
+}
+
+// fetchMetainfo adds a magnet link to client until its metadata arrives, then
+// drops it again if it was new to the client and canDrop agrees.
+func fetchMetainfo(client *torrent.Client, magnetURI string, timeout time.Duration, canDrop func() bool) (*metainfo.MetaInfo, error) {
+	spec, err := magnetSpec(magnetURI)
+	if err != nil {
+		return nil, err
+	}
+	t, isNew, err := client.AddTorrentSpec(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add magnet: %v", err)
+	}
+	if isNew {
+		defer func() {
+			if canDrop() {
+				t.Drop()
+			}
+		}()
+	}
+
+	select {
+	case <-t.GotInfo():
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("timeout waiting for torrent info")
+	}
+	mi := t.Metainfo()
+	// The client fills these in itself, they aren't from the torrent.
+	mi.Comment, mi.CreatedBy = "", ""
+	return &mi, nil
+}
@@ -0,0 +1,135 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// inspectedMsg carries the summary of the torrent shown on the inspect
+// screen.
+type inspectedMsg struct {
+	source  string
+	summary TorrentSummary
+	err     error
+}
+
+// openInspect shows the inspect screen, which previews a magnet link or
+// .torrent file without adding it.
+func (m *Model) openInspect() {
+	m.ShowInspect = true
+	m.Inspecting = false
+	m.InspectSummary = nil
+	m.InspectInput = newConfigInput("Magnet Link or .torrent File", "Enter magnet link or path", "")
+	m.InspectInput.Focus()
+}
+
+// inspect loads the torrent named in the input in the background.
+func (m *Model) inspect() tea.Cmd {
+	source := strings.TrimSpace(m.InspectInput.Value())
+	if source == "" {
+		return nil
+	}
+
+	m.Err = nil
+	m.InspectSource = source
+	m.Inspecting = true
+	return func() tea.Msg {
+		var mi *metainfo.MetaInfo
+		var err error
+		if strings.HasPrefix(source, "magnet:") {
+			mi, err = m.FetchMetainfo(source)
+		} else {
+			mi, err = LoadMetainfo(source)
+		}
+		if err != nil {
+			return inspectedMsg{source: source, err: err}
+		}
+		summary, err := Summarize(mi)
+		return inspectedMsg{source: source, summary: summary, err: err}
+	}
+}
+
+func (m *Model) updateInspect(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.String() == "ctrl+c" {
+		return m, tea.Quit
+	}
+
+	if m.InspectSummary != nil {
+		switch msg.String() {
+		case "esc":
+			m.InspectSummary = nil
+		case "a":
+			source := m.InspectSource
+			if strings.HasPrefix(source, "magnet:") {
+				go m.AddTorrent(source)
+			} else {
+				go m.AddTorrentFromFile(source)
+			}
+			m.ShowInspect = false
+			m.InspectSummary = nil
+		default:
+			var cmd tea.Cmd
+			m.Viewport, cmd = m.Viewport.Update(msg)
+			return m, cmd
+		}
+		return m, nil
+	}
+
+	switch msg.String() {
+	case "esc":
+		// Leaving while metadata is fetched drops the result.
+		m.ShowInspect = false
+		m.Inspecting = false
+		m.Err = nil
+		return m, nil
+	case "enter":
+		if m.Inspecting {
+			return m, nil
+		}
+		return m, m.inspect()
+	}
+
+	var cmd tea.Cmd
+	m.InspectInput, cmd = m.InspectInput.Update(msg)
+	return m, cmd
+}
+
+func (m *Model) handleInspected(msg inspectedMsg) {
+	if !m.ShowInspect || !m.Inspecting || msg.source != m.InspectSource {
+		return
+	}
+	m.Inspecting = false
+	if msg.err != nil {
+		m.Err = msg.err
+		return
+	}
+	m.Err = nil
+	m.InspectSummary = &msg.summary
+	m.Viewport.GotoTop()
+}
+
+func (m *Model) inspectView() string {
+	var s strings.Builder
+
+	if m.InspectSummary != nil {
+		s.WriteString(titleStyle.Render("Inspect: " + m.InspectSummary.Name))
+		s.WriteString("\n\n")
+		m.Viewport.SetContent(m.InspectSummary.Text())
+		s.WriteString(m.Viewport.View())
+		s.WriteString("\n\n'a' add torrent • ↑/↓ scroll • Esc to go back")
+		return s.String()
+	}
+
+	s.WriteString(titleStyle.Render("Inspect Torrent"))
+	s.WriteString("\n\n")
+	s.WriteString(m.InspectInput.View())
+	s.WriteString("\n")
+	if m.Inspecting {
+		s.WriteString("\nFetching metadata...")
+		return s.String()
+	}
+	s.WriteString("\nPress Enter to inspect, Esc to cancel")
+	return s.String()
+}
@@ -7,14 +7,18 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/time/rate"
 	_ "modernc.org/sqlite"
 )
 
@@ -33,6 +37,84 @@ type Model struct {
 	Config       Config
 	ShowConfig   bool
 	ConfigInputs []textinput.Model
+	Cursor       int
+	ShowDetails  bool
+	DetailHash   string
+	DetailTab    int
+	FileCursor   int
+	// collapsedDirs are the directories collapsed on the files tab.
+	collapsedDirs map[string]bool
+
+	ShowFeeds       bool
+	Feeds           []Feed
+	FeedCursor      int
+	FeedInputs      []textinput.Model
+	FeedEditID      int64
+	ShowFeedPreview bool
+	FeedPreview     []FeedMatch
+
+	ShowSchedule bool
+	ScheduleGrid Schedule
+	ScheduleDay  int
+	ScheduleHour int
+
+	ShowCreate   bool
+	CreateInputs []textinput.Model
+	// Creating is set while the data of a new torrent is hashed.
+	Creating     bool
+	createHashed atomic.Int64
+	createTotal  atomic.Int64
+
+	ShowInspect  bool
+	InspectInput textinput.Model
+	// InspectSource is the magnet link or .torrent file last inspected.
+	InspectSource  string
+	Inspecting     bool
+	InspectSummary *TorrentSummary
+
+	ShowAdd bool
+	// AddSource is the magnet link or .torrent file of the add dialog.
+	AddSource  string
+	AddLoading bool
+	AddSummary *TorrentSummary
+	AddInputs  []textinput.Model
+	// AddFocus is the focused input, or len(AddInputs) for the file list.
+	AddFocus      int
+	addFiles      []addFile
+	addFileCursor int
+	addMetainfo   *metainfo.MetaInfo
+
+	DownloadLimiter *rate.Limiter
+	UploadLimiter   *rate.Limiter
+	Notice          string
+	// StreamURL is the base URL files are streamed from, empty when the
+	// HTTP API isn't served.
+	StreamURL string
+
+	storages    map[string]storage.ClientImplCloser
+	completions map[string]storage.PieceCompletion
+	storagesMu  sync.Mutex
+	// configMu guards Config, configUpdateMu serializes UpdateConfig.
+	configMu       sync.RWMutex
+	configUpdateMu sync.Mutex
+	// moveMu is held while a completed torrent is moved, when it isn't on
+	// the client. moveWG tracks the moves started, which Close waits for.
+	moveMu sync.Mutex
+	moveWG sync.WaitGroup
+
+	peerUploads peerUploads
+
+	watchMu   sync.Mutex
+	watchStop chan struct{}
+	watchWG   sync.WaitGroup
+
+	feedStop chan struct{}
+	feedWG   sync.WaitGroup
+
+	schedule     Schedule
+	scheduleMu   sync.Mutex
+	scheduleStop chan struct{}
+	scheduleWG   sync.WaitGroup
 }
 
 type TorrentItem struct {
@@ -50,17 +132,86 @@ type TorrentItem struct {
 	UploadSpeed float64
 	Downloaded  int64
 	Uploaded    int64
+
+	// UploadedBase is the number of bytes uploaded in previous sessions.
+	UploadedBase int64
+	// LastUploaded is the number of bytes uploaded this session at
+	// LastUpdate, for the upload speed.
+	LastUploaded int64
+	SeedingTime  time.Duration
+	LastSaved    time.Time
+	SavePath     string
+	// CompletedPath is where the data is moved once the download is
+	// complete, empty if it stays in SavePath.
+	CompletedPath string
+	Label         string
+	// QueuePosition orders torrents for the queue, lowest first.
+	QueuePosition int
+	Sequential    bool
+
+	Trackers        []TrackerStatus
+	TrackersScraped time.Time
+}
+
+// Ratio returns the share ratio of the torrent, uploaded over downloaded bytes.
+func (item *TorrentItem) Ratio() float64 {
+	if item.Downloaded == 0 {
+		return 0
+	}
+	return float64(item.Uploaded) / float64(item.Downloaded)
 }
 
 type Config struct {
-	DownloadDir    string
-	MaxConnections int
-	SeedRatio      float64
-	DownloadLimit  int64
-	UploadLimit    int64
+	DownloadDir    string  `json:"download_dir"`
+	MaxConnections int     `json:"max_connections"`
+	SeedRatio      float64 `json:"seed_ratio"`
+	DownloadLimit  int64   `json:"download_limit"`
+	UploadLimit    int64   `json:"upload_limit"`
+	SeedTime       int     `json:"seed_time"`
+	ListenPort     int     `json:"listen_port"`
+
+	// AuthPassword is a bcrypt hash and APIToken a SHA-256 hash; neither is
+	// ever sent to clients.
+	AuthUsername  string `json:"auth_username"`
+	AuthPassword  string `json:"-"`
+	APIToken      string `json:"-"`
+	TLS           bool   `json:"tls"`
+	TLSCert       string `json:"tls_cert"`
+	TLSKey        string `json:"tls_key"`
+	LoginAttempts int    `json:"login_attempts"`
+
+	WatchDirs []WatchDir `json:"watch_dirs"`
+	// FeedInterval is how often feeds are checked, in minutes; 0 disables
+	// automatic checks.
+	FeedInterval int `json:"feed_interval"`
+
+	// MaxActiveDownloads and MaxActiveSeeds limit how many torrents transfer
+	// at once, the rest wait in the queue; 0 means no limit.
+	MaxActiveDownloads int `json:"max_active_downloads"`
+	MaxActiveSeeds     int `json:"max_active_seeds"`
+
+	// The alternate speed limits are used instead of DownloadLimit and
+	// UploadLimit while AltSpeed is on, which the schedule switches when
+	// AltSpeedSchedule is set.
+	AltDownloadLimit int64 `json:"alt_download_limit"`
+	AltUploadLimit   int64 `json:"alt_upload_limit"`
+	AltSpeed         bool  `json:"alt_speed"`
+	AltSpeedSchedule bool  `json:"alt_speed_schedule"`
+
+	// New downloads are stored in IncompleteDir, if set, and moved to their
+	// save path once complete. Those added without a save path end up in
+	// the directory of their label in LabelDirs, or else in CompletedDir,
+	// or else in DownloadDir.
+	IncompleteDir string     `json:"incomplete_dir"`
+	CompletedDir  string     `json:"completed_dir"`
+	LabelDirs     []LabelDir `json:"label_dirs"`
 }
 
 func InitialModel() (*Model, error) {
+	dbPath, err := databasePath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the database: %v", err)
+	}
 	db, err := sql.Open("sqlite", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %v", err)
@@ -71,18 +222,28 @@ func InitialModel() (*Model, error) {
 		return nil, fmt.Errorf("failed to initialize database: %v", err)
 	}
 
-	cfg := torrent.NewDefaultClientConfig()
-	cfg.DataDir = filepath.Join(homeDir, "Downloads")
-	cfg.EstablishedConnsPerTorrent = 50
-	cfg.MaxUnverifiedBytes = 1 << 30
-	cfg.DisableIPv6 = false
-	cfg.DisableTCP = false
-	cfg.DisableUTP = false
-	cfg.NoDHT = false
-	cfg.NoUpload = false
-	cfg.Seed = true
-
-	client, err := torrent.NewClient(cfg)
+	var m = &Model{
+		Torrents:   make(map[string]*TorrentItem),
+		DB:         db,
+		LastRender: time.Now(),
+	}
+
+	exists, err := CheckConfigExists(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		if err := m.LoadConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	download, upload := m.SpeedLimits()
+	m.DownloadLimiter = newRateLimiter(download, downloadBurst)
+	m.UploadLimiter = newRateLimiter(upload, uploadBurst)
+
+	client, err := torrent.NewClient(m.newClientConfig())
 	if err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to create torrent client: %v", err)
@@ -102,47 +263,53 @@ func InitialModel() (*Model, error) {
 		BorderForeground(lipgloss.Color("62")).
 		PaddingRight(2)
 
-	var m = &Model{}
+	m.TextInput = ti
+	m.Progress = prog
+	m.Viewport = vp
+	m.Client = client
 
-	exists, err := CheckConfigExists(db)
-	if err != nil {
-		return nil, err
+	if err := m.RestoreActiveTorrents(); err != nil {
+		fmt.Printf("Warning: couldn't restore torrents: %v\n", err)
 	}
+	m.startWatching()
+	m.startFeeds()
+	m.startScheduler()
 
-	m = &Model{
-		TextInput:  ti,
-		Progress:   prog,
-		Viewport:   vp,
-		Torrents:   make(map[string]*TorrentItem),
-		Client:     client,
-		DB:         db,
-		LastRender: time.Now(),
-	}
+	return m, nil
+}
 
-	if exists {
-		if err := m.LoadConfig(); err != nil {
-			return nil, err
+// Close saves the state of all torrents, shuts the torrent client down and
+// checkpoints and closes the database.
+func (m *Model) Close() error {
+	m.stopWatching()
+	m.stopFeeds()
+	m.stopScheduler()
+	// Moved torrents are put back on the client and saved when done.
+	m.moveWG.Wait()
+
+	m.Mu.Lock()
+	for infoHash, item := range m.Torrents {
+		if err := m.SaveTorrentState(infoHash, item); err != nil {
+			m.Err = err
 		}
 	}
+	m.Mu.Unlock()
 
-	// m := &Model{
-	// 	TextInput:  ti,
-	// 	Progress:   prog,
-	// 	Viewport:   vp,
-	// 	Torrents:   make(map[string]*TorrentItem),
-	// 	Client:     client,
-	// 	DB:         db,
-	// 	LastRender: time.Now(),
-	// }
+	m.Client.Close()
+	m.closeStorages()
 
-	if err := m.RestoreActiveTorrents(); err != nil {
-		fmt.Printf("Warning: couldn't restore torrents: %v\n", err)
+	_, err := m.DB.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	if err != nil {
+		err = fmt.Errorf("error checkpointing WAL: %v", err)
 	}
-
-	return m, nil
+	m.DB.Close()
+	return err
 }
 
 func (m *Model) Init() tea.Cmd {
+	if m.ShowAdd && m.AddLoading {
+		return tea.Batch(textinput.Blink, m.UpdateTorrents, m.loadAdd())
+	}
 	return tea.Batch(textinput.Blink, m.UpdateTorrents)
 }
 
@@ -155,26 +322,73 @@ func newConfigInput(label, placeholder, value string) textinput.Model {
 	return i
 }
 
+// newSecretInput creates a config input for a password or token, which is
+// masked and never shows the stored value.
+func newSecretInput(label, placeholder string) textinput.Model {
+	i := newConfigInput(label, placeholder, "")
+	i.EchoMode = textinput.EchoPassword
+	return i
+}
+
 func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.ShowDetails {
+			return m.updateDetails(msg)
+		}
+		if m.ShowFeeds {
+			return m.updateFeeds(msg)
+		}
+		if m.ShowSchedule {
+			return m.updateSchedule(msg)
+		}
+		if m.ShowCreate {
+			return m.updateCreate(msg)
+		}
+		if m.ShowInspect {
+			return m.updateInspect(msg)
+		}
+		if m.ShowAdd {
+			return m.updateAdd(msg)
+		}
+
 		switch msg.String() {
 		case "c":
 			if !m.ShowConfig {
 				m.ShowConfig = true
 
-				if m.Config.DownloadDir == "" {
-					m.Config.DownloadDir = filepath.Join(homeDir, "Downloads")
+				cfg := m.ConfigSnapshot()
+				if cfg.DownloadDir == "" {
+					cfg.DownloadDir = filepath.Join(homeDir, "Downloads")
 				}
 
 				m.ConfigInputs = []textinput.Model{
-					newConfigInput("Download Directory", m.Config.DownloadDir, ""),
-					newConfigInput("Max Connections", "Enter max connections", strconv.Itoa(m.Config.MaxConnections)),
-					newConfigInput("Seed Ratio", "Enter seed ratio", fmt.Sprintf("%.2f", m.Config.SeedRatio)),
-					newConfigInput("Download Limit (KB/s, 0 for unlimited)", "Enter download limit", strconv.FormatInt(m.Config.DownloadLimit, 10)),
-					newConfigInput("Upload Limit (KB/s, 0 for unlimited)", "Enter upload limit", strconv.FormatInt(m.Config.UploadLimit, 10)),
+					newConfigInput("Download Directory", "Enter download directory", cfg.DownloadDir),
+					newConfigInput("Max Connections", "Enter max connections", strconv.Itoa(cfg.MaxConnections)),
+					newConfigInput("Seed Ratio", "Enter seed ratio", fmt.Sprintf("%.2f", cfg.SeedRatio)),
+					newConfigInput("Download Limit (KB/s, 0 for unlimited)", "Enter download limit", strconv.FormatInt(cfg.DownloadLimit, 10)),
+					newConfigInput("Upload Limit (KB/s, 0 for unlimited)", "Enter upload limit", strconv.FormatInt(cfg.UploadLimit, 10)),
+					newConfigInput("Seed Time (minutes, 0 for unlimited)", "Enter seed time", strconv.Itoa(cfg.SeedTime)),
+					newConfigInput("Listen Port", "Enter listen port", strconv.Itoa(cfg.ListenPort)),
+					newConfigInput("Web Username", "Enter username", cfg.AuthUsername),
+					newSecretInput("Web Password", "Empty keeps current, '-' removes"),
+					newSecretInput("API Token", "Empty keeps current, '-' removes, 'new' generates"),
+					newConfigInput("TLS (on/off)", "Enter on or off", onOff(cfg.TLS)),
+					newConfigInput("TLS Certificate", "Empty for a self-signed certificate", cfg.TLSCert),
+					newConfigInput("TLS Key", "Empty for a self-signed certificate", cfg.TLSKey),
+					newConfigInput("Lockout After Failed Logins (0 to disable)", "Enter failed login limit", strconv.Itoa(cfg.LoginAttempts)),
+					newConfigInput("Watch Directories (dir|download dir|label; ...)", "Enter watch directories", formatWatchDirs(cfg.WatchDirs)),
+					newConfigInput("Feed Check Interval (minutes, 0 to disable)", "Enter feed check interval", strconv.Itoa(cfg.FeedInterval)),
+					newConfigInput("Max Active Downloads (0 for unlimited)", "Enter max active downloads", strconv.Itoa(cfg.MaxActiveDownloads)),
+					newConfigInput("Max Active Seeds (0 for unlimited)", "Enter max active seeds", strconv.Itoa(cfg.MaxActiveSeeds)),
+					newConfigInput("Alt Download Limit (KB/s, 0 for unlimited)", "Enter alternate download limit", strconv.FormatInt(cfg.AltDownloadLimit, 10)),
+					newConfigInput("Alt Upload Limit (KB/s, 0 for unlimited)", "Enter alternate upload limit", strconv.FormatInt(cfg.AltUploadLimit, 10)),
+					newConfigInput("Alt Speed Schedule (on/off)", "Enter on or off", onOff(cfg.AltSpeedSchedule)),
+					newConfigInput("Incomplete Directory", "Empty to download in place", cfg.IncompleteDir),
+					newConfigInput("Completed Directory", "Empty to leave data where it is", cfg.CompletedDir),
+					newConfigInput("Label Directories (label|dir; ...)", "Enter label directories", formatLabelDirs(cfg.LabelDirs)),
 				}
 				m.ConfigInputs[0].Focus()
 				return m, nil
@@ -186,26 +400,112 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		case "ctrl+c", "q":
 			return m, tea.Quit
+		case "up", "down":
+			if !m.ShowConfig {
+				m.moveCursor(msg.String())
+				return m, nil
+			}
+		case "f":
+			if !m.ShowConfig && m.TextInput.Value() == "" {
+				m.openDetails(tabFiles)
+				return m, nil
+			}
+		case "A":
+			if !m.ShowConfig && m.TextInput.Value() == "" {
+				if err := m.SetAltSpeed(!m.ConfigSnapshot().AltSpeed); err != nil {
+					m.Err = err
+				}
+				return m, nil
+			}
+		case "S":
+			if !m.ShowConfig && m.TextInput.Value() == "" {
+				m.openSchedule()
+				return m, nil
+			}
+		case "R":
+			if !m.ShowConfig && m.TextInput.Value() == "" {
+				m.openFeeds()
+				return m, nil
+			}
+		case "n":
+			if !m.ShowConfig && m.TextInput.Value() == "" {
+				m.openCreate()
+				return m, nil
+			}
+		case "i":
+			if !m.ShowConfig && m.TextInput.Value() == "" {
+				m.openInspect()
+				return m, nil
+			}
+		case "s":
+			if !m.ShowConfig && m.TextInput.Value() == "" {
+				m.toggleSequential()
+				return m, nil
+			}
+		case "K", "J", "T":
+			if !m.ShowConfig && m.TextInput.Value() == "" {
+				m.moveSelected(map[string]string{"K": QueueUp, "J": QueueDown, "T": QueueTop}[msg.String()])
+				return m, nil
+			}
+		case "p", "r", "d", "D":
+			// Letters only act on the selection while nothing is being typed.
+			if !m.ShowConfig && m.TextInput.Value() == "" {
+				m.handleTorrentAction(msg.String())
+				return m, nil
+			}
 		case "enter":
 			if m.ShowConfig {
-				m.Config.DownloadDir = m.ConfigInputs[0].Value()
-				m.Config.MaxConnections, _ = strconv.Atoi(m.ConfigInputs[1].Value())
-				m.Config.SeedRatio, _ = strconv.ParseFloat(m.ConfigInputs[2].Value(), 64)
-				m.Config.DownloadLimit, _ = strconv.ParseInt(m.ConfigInputs[3].Value(), 10, 64)
-				m.Config.UploadLimit, _ = strconv.ParseInt(m.ConfigInputs[4].Value(), 10, 64)
-
-				if err := m.SaveConfig(); err != nil {
+				cfg := m.ConfigSnapshot()
+				cfg.DownloadDir = m.ConfigInputs[0].Value()
+				cfg.MaxConnections, _ = strconv.Atoi(m.ConfigInputs[1].Value())
+				cfg.SeedRatio, _ = strconv.ParseFloat(m.ConfigInputs[2].Value(), 64)
+				cfg.DownloadLimit, _ = strconv.ParseInt(m.ConfigInputs[3].Value(), 10, 64)
+				cfg.UploadLimit, _ = strconv.ParseInt(m.ConfigInputs[4].Value(), 10, 64)
+				cfg.SeedTime, _ = strconv.Atoi(m.ConfigInputs[5].Value())
+				cfg.ListenPort, _ = strconv.Atoi(m.ConfigInputs[6].Value())
+				cfg.AuthUsername = m.ConfigInputs[7].Value()
+				var token string
+				cfg.APIToken, token = updateToken(cfg.APIToken, m.ConfigInputs[9].Value())
+				cfg.TLS = isOn(m.ConfigInputs[10].Value())
+				cfg.TLSCert = m.ConfigInputs[11].Value()
+				cfg.TLSKey = m.ConfigInputs[12].Value()
+				cfg.LoginAttempts, _ = strconv.Atoi(m.ConfigInputs[13].Value())
+				cfg.WatchDirs = parseWatchDirs(m.ConfigInputs[14].Value())
+				cfg.FeedInterval, _ = strconv.Atoi(m.ConfigInputs[15].Value())
+				cfg.MaxActiveDownloads, _ = strconv.Atoi(m.ConfigInputs[16].Value())
+				cfg.MaxActiveSeeds, _ = strconv.Atoi(m.ConfigInputs[17].Value())
+				cfg.AltDownloadLimit, _ = strconv.ParseInt(m.ConfigInputs[18].Value(), 10, 64)
+				cfg.AltUploadLimit, _ = strconv.ParseInt(m.ConfigInputs[19].Value(), 10, 64)
+				cfg.AltSpeedSchedule = isOn(m.ConfigInputs[20].Value())
+				cfg.IncompleteDir = strings.TrimSpace(m.ConfigInputs[21].Value())
+				cfg.CompletedDir = strings.TrimSpace(m.ConfigInputs[22].Value())
+				cfg.LabelDirs = parseLabelDirs(m.ConfigInputs[23].Value())
+
+				var err error
+				cfg.AuthPassword, err = updatePassword(cfg.AuthPassword, m.ConfigInputs[8].Value())
+				if err == nil {
+					err = m.UpdateConfig(cfg)
+				}
+				if err != nil {
 					m.Err = err
+					m.Notice = ""
 				} else {
+					m.Err = nil
 					m.ShowConfig = false
-					m.ApplyConfig()
+					if token != "" {
+						m.Notice += " • New API token: " + token
+					}
 				}
 				return m, nil
 			} else {
 				magnetLink := strings.TrimSpace(m.TextInput.Value())
 				if magnetLink != "" {
-					go m.AddTorrent(magnetLink)
+					m.OpenAdd(magnetLink)
 					m.TextInput.Reset()
+					return m, m.loadAdd()
+				} else {
+					m.openDetails(tabFiles)
+					return m, nil
 				}
 			}
 		case "tab":
@@ -222,6 +522,26 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+	case feedPreviewMsg, feedCheckedMsg:
+		m.handleFeedMsg(msg)
+		return m, nil
+
+	case torrentCreatedMsg:
+		m.handleCreated(msg)
+		return m, nil
+
+	case inspectedMsg:
+		m.handleInspected(msg)
+		return m, nil
+
+	case addLoadedMsg:
+		m.handleAddLoaded(msg)
+		return m, nil
+
+	case torrentAddedMsg:
+		m.handleAdded(msg)
+		return m, nil
+
 	case tea.WindowSizeMsg:
 		m.Width = msg.Width
 		m.Height = msg.Height
@@ -234,6 +554,10 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		m.LastRender = time.Now()
 
+		if m.ShowDetails {
+			m.refreshTrackers()
+		}
+
 		return m, tea.Batch(
 			tea.Every(time.Second, func(t time.Time) tea.Msg {
 				return tickMsg{}
@@ -257,6 +581,44 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+func (m *Model) moveCursor(key string) {
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+
+	if key == "up" {
+		m.Cursor--
+	} else {
+		m.Cursor++
+	}
+	m.clampCursor()
+}
+
+func (m *Model) handleTorrentAction(key string) {
+	m.Mu.RLock()
+	infoHash := m.selectedHash()
+	m.Mu.RUnlock()
+	if infoHash == "" {
+		return
+	}
+
+	go func() {
+		var err error
+		switch key {
+		case "p":
+			err = m.PauseTorrent(infoHash)
+		case "r":
+			err = m.ResumeTorrent(infoHash)
+		case "d":
+			err = m.RemoveTorrent(infoHash, false)
+		case "D":
+			err = m.RemoveTorrent(infoHash, true)
+		}
+		if err != nil {
+			m.Err = err
+		}
+	}()
+}
+
 func (m *Model) handleUpdates(msg tea.Msg) tea.Cmd {
 	var cmd tea.Cmd
 	m.TextInput, cmd = m.TextInput.Update(msg)
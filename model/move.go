@@ -0,0 +1,228 @@
+package model
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// LabelDir is the directory the data of torrents with a label is moved to
+// once they complete.
+type LabelDir struct {
+	Label string `json:"label"`
+	Path  string `json:"path"`
+}
+
+// parseLabelDirs reads label directories in the form the config screen and
+// config table use: "label|dir" entries separated by ";".
+func parseLabelDirs(value string) []LabelDir {
+	var dirs []LabelDir
+	for _, entry := range strings.Split(value, ";") {
+		label, path, ok := strings.Cut(entry, "|")
+		label, path = strings.TrimSpace(label), strings.TrimSpace(path)
+		if !ok || label == "" || path == "" {
+			continue
+		}
+		dirs = append(dirs, LabelDir{Label: label, Path: path})
+	}
+	return dirs
+}
+
+func formatLabelDirs(dirs []LabelDir) string {
+	entries := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		entries = append(entries, dir.Label+"|"+dir.Path)
+	}
+	return strings.Join(entries, "; ")
+}
+
+// downloadPaths returns the directory a new torrent is downloaded to and the
+// one its data is moved to once complete, which is empty if it stays.
+//
+// The data ends up in the save path of opts, or else the directory of its
+// label, the completed directory or the download directory, in that order.
+// It is downloaded there directly unless an incomplete directory is set, or
+// the save path of opts is empty and the data ends up somewhere other than
+// the download directory. Data already in its final place is used where it
+// is, which needs the info of the torrent.
+func (m *Model) downloadPaths(opts AddOptions, info *metainfo.Info) (savePath, completedPath string) {
+	cfg := m.ConfigSnapshot()
+	final := opts.SavePath
+	if final == "" {
+		for _, dir := range cfg.LabelDirs {
+			if opts.Label != "" && dir.Label == opts.Label {
+				final = dir.Path
+				break
+			}
+		}
+	}
+	if final == "" {
+		final = cfg.CompletedDir
+	}
+	if final == "" {
+		final = m.dataDir()
+	}
+
+	switch {
+	case info != nil && dataExists(final, info):
+		savePath = final
+	case cfg.IncompleteDir != "":
+		savePath = cfg.IncompleteDir
+	case opts.SavePath != "":
+		savePath = opts.SavePath
+	default:
+		savePath = m.dataDir()
+	}
+
+	if filepath.Clean(savePath) == filepath.Clean(final) {
+		return savePath, ""
+	}
+	return savePath, final
+}
+
+// dataExists reports whether any file of a torrent is found below dir.
+func dataExists(dir string, info *metainfo.Info) bool {
+	for _, fi := range info.UpvertedFiles() {
+		if _, err := os.Stat(filepath.Join(dir, dataPath(info, fi))); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// dataPath is where the file fi of a torrent is stored, relative to its save
+// path.
+func dataPath(info *metainfo.Info, fi metainfo.FileInfo) string {
+	return storagePath(storage.FilePathMakerOpts{Info: info, File: &fi})
+}
+
+// moveCompleted moves the data of a completed torrent from its save path to
+// its completed path, then seeds it from there. The torrent is off the client
+// while its files move, and is put back from st, the way a restart would.
+// Pieces that were complete are marked so, rather than hashed again.
+func (m *Model) moveCompleted(infoHash string, t *torrent.Torrent, st storedTorrent) {
+	defer m.moveWG.Done()
+
+	// The client mustn't be rebuilt while the torrent isn't on it.
+	m.moveMu.Lock()
+	defer m.moveMu.Unlock()
+
+	m.Mu.RLock()
+	item, exists := m.Torrents[infoHash]
+	exists = exists && item.Torrent == t
+	m.Mu.RUnlock()
+	if !exists {
+		return
+	}
+
+	info := t.Info()
+	var complete []int
+	for i := range t.NumPieces() {
+		if t.Piece(i).State().Complete {
+			complete = append(complete, i)
+		}
+	}
+	t.Drop()
+
+	verify := false
+	if err := moveData(info, st.SavePath, st.CompletedPath); err != nil {
+		// Whatever was moved is downloaded again, the torrent isn't moved
+		// again.
+		m.Err = fmt.Errorf("failed to move %s to %s: %v", info.BestName(), st.CompletedPath, err)
+		verify = true
+	} else {
+		completion := m.pieceCompletionFor(st.CompletedPath)
+		for _, i := range complete {
+			if err := completion.Set(metainfo.PieceKey{InfoHash: t.InfoHash(), Index: i}, true); err != nil {
+				verify = true
+			}
+		}
+		st.SavePath = st.CompletedPath
+	}
+	st.CompletedPath = ""
+
+	m.restoreTorrent(st, verify)
+}
+
+// moveData moves the files of a torrent from one save path to another. Files
+// that were never created are skipped, and directories left empty behind are
+// removed. Nothing is moved if a file would replace one already there.
+func moveData(info *metainfo.Info, from, to string) error {
+	for _, fi := range info.UpvertedFiles() {
+		rel := dataPath(info, fi)
+		if _, err := os.Stat(filepath.Join(from, rel)); os.IsNotExist(err) {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(to, rel)); err == nil {
+			return fmt.Errorf("%s already exists", filepath.Join(to, rel))
+		}
+	}
+
+	for _, fi := range info.UpvertedFiles() {
+		if strings.Contains(fi.Attr, "p") {
+			continue
+		}
+		rel := dataPath(info, fi)
+		src, dst := filepath.Join(from, rel), filepath.Join(to, rel)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		if err := moveFile(src, dst); err != nil {
+			return err
+		}
+		removeEmptyDirs(filepath.Dir(src), from)
+	}
+	return nil
+}
+
+// moveFile renames a file, or copies and removes it if it can't be renamed,
+// e.g. to another file system. It fails if dst exists, rather than replace
+// it.
+func moveFile(src, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// removeEmptyDirs removes dir and its parents up to, but not including, root
+// for as long as they are empty.
+func removeEmptyDirs(dir, root string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
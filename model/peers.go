@@ -0,0 +1,80 @@
+package model
+
+import (
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+// peerUploads estimates how fast each connected peer is uploaded to from the
+// blocks it requests. The client only counts the bytes it sends per torrent.
+// Blocks requested while the peer is choked or the upload limit is reached
+// are counted all the same, so the estimate can be too high.
+type peerUploads struct {
+	mu    sync.Mutex
+	peers map[*torrent.PeerConn]*peerUpload
+}
+
+type peerUpload struct {
+	requested int64
+	// sampled is requested at sampledAt, when rate was last worked out.
+	sampled   int64
+	sampledAt time.Time
+	rate      float64
+}
+
+// readMessage counts the blocks requested by a peer. It is called by the
+// client for every message read.
+func (u *peerUploads) readMessage(pc *torrent.PeerConn, msg *pp.Message) {
+	if msg.Type != pp.Request {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.peers == nil {
+		u.peers = make(map[*torrent.PeerConn]*peerUpload)
+	}
+	p, ok := u.peers[pc]
+	if !ok {
+		p = &peerUpload{sampledAt: time.Now()}
+		u.peers[pc] = p
+	}
+	p.requested += int64(msg.Length)
+}
+
+func (u *peerUploads) closed(pc *torrent.PeerConn) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.peers, pc)
+}
+
+// uploadsAllowed reports whether the client serves the requests of the peers
+// of a torrent at all.
+func uploadsAllowed(item *TorrentItem) bool {
+	switch item.State {
+	case "paused", "finished", "queued":
+		return false
+	}
+	return true
+}
+
+// rate returns the estimated upload rate to a peer in bytes per second,
+// averaged over at least a second.
+func (u *peerUploads) rate(pc *torrent.PeerConn) float64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	p, ok := u.peers[pc]
+	if !ok {
+		return 0
+	}
+	if elapsed := time.Since(p.sampledAt); elapsed >= time.Second {
+		p.rate = float64(p.requested-p.sampled) / elapsed.Seconds()
+		p.sampled = p.requested
+		p.sampledAt = time.Now()
+	}
+	return p.rate
+}
@@ -0,0 +1,159 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Directions a torrent can be moved in the queue.
+const (
+	QueueTop    = "top"
+	QueueUp     = "up"
+	QueueDown   = "down"
+	QueueBottom = "bottom"
+)
+
+// nextQueuePosition returns the position at the end of the queue. The caller
+// must hold m.Mu.
+func (m *Model) nextQueuePosition() int {
+	last := 0
+	for _, item := range m.Torrents {
+		last = max(last, item.QueuePosition)
+	}
+	return last + 1
+}
+
+// applyQueue starts and queues torrents so that at most
+// Config.MaxActiveDownloads are downloading and Config.MaxActiveSeeds are
+// seeding, giving the slots to the torrents nearest the top of the queue. A
+// limit of 0 means no limit. Paused and finished torrents don't take a slot,
+// and neither do torrents without their info yet, whatever their state, as
+// they can't be told apart from seeds and need peers to get it. The caller
+// must hold m.Mu.
+func (m *Model) applyQueue() {
+	cfg := m.ConfigSnapshot()
+	downloads, seeds := 0, 0
+	for _, infoHash := range m.torrentHashes() {
+		item := m.Torrents[infoHash]
+		switch item.State {
+		case "paused", "finished", "verifying", "moving":
+			continue
+		}
+		if item.Torrent.Info() == nil {
+			// Queued by an earlier session, it would never get its info.
+			if item.State == "queued" {
+				m.startQueued(infoHash, item)
+			}
+			continue
+		}
+
+		var active bool
+		if downloadComplete(item.Torrent) {
+			seeds++
+			active = cfg.MaxActiveSeeds <= 0 || seeds <= cfg.MaxActiveSeeds
+		} else {
+			downloads++
+			active = cfg.MaxActiveDownloads <= 0 || downloads <= cfg.MaxActiveDownloads
+		}
+
+		if active && item.State == "queued" {
+			m.startQueued(infoHash, item)
+		} else if !active && item.State != "queued" {
+			m.queueTorrent(infoHash, item)
+		}
+	}
+}
+
+// queueTorrent stops the transfers of a torrent until a slot frees up.
+func (m *Model) queueTorrent(infoHash string, item *TorrentItem) {
+	item.Torrent.DisallowDataDownload()
+	item.Torrent.DisallowDataUpload()
+	item.Torrent.SetMaxEstablishedConns(0)
+	item.State = "queued"
+	item.Speed = 0
+	item.UploadSpeed = 0
+
+	if err := m.SaveTorrentState(infoHash, item); err != nil {
+		m.Err = err
+	}
+}
+
+// startQueued lets a queued torrent transfer data again.
+func (m *Model) startQueued(infoHash string, item *TorrentItem) {
+	item.Torrent.SetMaxEstablishedConns(m.maxConnections())
+	item.Torrent.AllowDataDownload()
+	item.Torrent.AllowDataUpload()
+	item.State = "connecting"
+	if downloadComplete(item.Torrent) {
+		item.State = "seeding"
+	}
+
+	if err := m.SaveTorrentState(infoHash, item); err != nil {
+		m.Err = err
+	}
+}
+
+// MoveInQueue moves a torrent to the top or bottom of the queue, or one place
+// up or down, and starts or queues torrents for the new order.
+func (m *Model) MoveInQueue(infoHash, direction string) error {
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+
+	hashes := m.torrentHashes()
+	from := slices.Index(hashes, infoHash)
+	if from < 0 {
+		return fmt.Errorf("torrent %s not found", infoHash)
+	}
+
+	var to int
+	switch direction {
+	case QueueTop:
+		to = 0
+	case QueueUp:
+		to = max(from-1, 0)
+	case QueueDown:
+		to = min(from+1, len(hashes)-1)
+	case QueueBottom:
+		to = len(hashes) - 1
+	default:
+		return fmt.Errorf("unknown queue direction %q", direction)
+	}
+
+	hashes = slices.Insert(slices.Delete(hashes, from, from+1), to, infoHash)
+
+	// Number the whole queue again, which also closes any gaps left by
+	// removed torrents.
+	positions := make(map[string]int)
+	for i, h := range hashes {
+		if item := m.Torrents[h]; item.QueuePosition != i+1 {
+			item.QueuePosition = i + 1
+			positions[h] = i + 1
+		}
+	}
+	if err := m.SaveQueuePositions(positions); err != nil {
+		return err
+	}
+
+	m.applyQueue()
+	return nil
+}
+
+// moveSelected moves the torrent under the cursor in the queue, keeping the
+// cursor on it.
+func (m *Model) moveSelected(direction string) {
+	m.Mu.RLock()
+	infoHash := m.selectedHash()
+	m.Mu.RUnlock()
+	if infoHash == "" {
+		return
+	}
+
+	if err := m.MoveInQueue(infoHash, direction); err != nil {
+		m.Err = err
+		return
+	}
+
+	m.Mu.Lock()
+	m.Cursor = slices.Index(m.torrentHashes(), infoHash)
+	m.Mu.Unlock()
+}
@@ -0,0 +1,154 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// scheduleCheckInterval is how often the scheduler looks at the clock.
+const scheduleCheckInterval = 30 * time.Second
+
+// Schedule holds for every hour of the week whether the alternate speed
+// limits are on, indexed by time.Weekday and hour.
+type Schedule [7][24]bool
+
+// At reports whether the schedule has the alternate speed limits on at t.
+func (s Schedule) At(t time.Time) bool {
+	return s[t.Weekday()][t.Hour()]
+}
+
+// SpeedLimits returns the download and upload limits in effect in KB/s, which
+// are the alternate ones while Config.AltSpeed is on. 0 means unlimited.
+func (m *Model) SpeedLimits() (download, upload int64) {
+	cfg := m.ConfigSnapshot()
+	if cfg.AltSpeed {
+		return cfg.AltDownloadLimit, cfg.AltUploadLimit
+	}
+	return cfg.DownloadLimit, cfg.UploadLimit
+}
+
+func (m *Model) LoadSchedule() (Schedule, error) {
+	var s Schedule
+	rows, err := m.DB.Query("SELECT day, hour FROM speed_schedule")
+	if err != nil {
+		return s, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day, hour int
+		if err := rows.Scan(&day, &hour); err != nil {
+			return s, err
+		}
+		if day >= 0 && day < 7 && hour >= 0 && hour < 24 {
+			s[day][hour] = true
+		}
+	}
+	return s, rows.Err()
+}
+
+// SaveSchedule stores the schedule and makes it the one the scheduler
+// follows.
+func (m *Model) SaveSchedule(s Schedule) error {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM speed_schedule"); err != nil {
+		return fmt.Errorf("failed to save schedule: %v", err)
+	}
+	for day := range s {
+		for hour, on := range s[day] {
+			if !on {
+				continue
+			}
+			if _, err := tx.Exec("INSERT INTO speed_schedule (day, hour) VALUES (?, ?)", day, hour); err != nil {
+				return fmt.Errorf("failed to save schedule: %v", err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	m.scheduleMu.Lock()
+	m.schedule = s
+	m.scheduleMu.Unlock()
+	return nil
+}
+
+// SetAltSpeed turns the alternate speed limits on or off.
+func (m *Model) SetAltSpeed(on bool) error {
+	cfg := m.ConfigSnapshot()
+	cfg.AltSpeed = on
+	if err := m.UpdateConfig(cfg); err != nil {
+		return err
+	}
+	m.Notice = "Alternate speed limits off"
+	if on {
+		m.Notice = "Alternate speed limits on"
+	}
+	return nil
+}
+
+// startScheduler switches the alternate speed limits on and off following
+// the schedule while Config.AltSpeedSchedule is set. It only acts when the
+// schedule changes from one hour to the next, so turning the alternate
+// limits on or off by hand lasts until the next scheduled change.
+func (m *Model) startScheduler() {
+	s, err := m.LoadSchedule()
+	if err != nil {
+		m.Err = fmt.Errorf("failed to load schedule: %v", err)
+	}
+	m.schedule = s
+
+	m.scheduleStop = make(chan struct{})
+	m.scheduleWG.Add(1)
+
+	go func() {
+		defer m.scheduleWG.Done()
+
+		ticker := time.NewTicker(scheduleCheckInterval)
+		defer ticker.Stop()
+
+		// last is the scheduled state at the previous check, nil until the
+		// schedule is first followed.
+		var last *bool
+		for {
+			if cfg := m.ConfigSnapshot(); cfg.AltSpeedSchedule {
+				m.scheduleMu.Lock()
+				want := m.schedule.At(time.Now())
+				m.scheduleMu.Unlock()
+
+				if last == nil || *last != want {
+					last = &want
+					if want != cfg.AltSpeed {
+						if err := m.SetAltSpeed(want); err != nil {
+							m.Err = err
+						}
+					}
+				}
+			} else {
+				last = nil
+			}
+
+			select {
+			case <-m.scheduleStop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (m *Model) stopScheduler() {
+	if m.scheduleStop != nil {
+		close(m.scheduleStop)
+		m.scheduleWG.Wait()
+	}
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// openSchedule shows the schedule grid with a copy of the current schedule,
+// which is only saved when the user confirms.
+func (m *Model) openSchedule() {
+	m.scheduleMu.Lock()
+	m.ScheduleGrid = m.schedule
+	m.scheduleMu.Unlock()
+
+	now := time.Now()
+	m.ShowSchedule = true
+	m.ScheduleDay = int(now.Weekday())
+	m.ScheduleHour = now.Hour()
+}
+
+func (m *Model) updateSchedule(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return m, tea.Quit
+	case "esc":
+		m.ShowSchedule = false
+	case "up":
+		m.ScheduleDay = (m.ScheduleDay + 6) % 7
+	case "down":
+		m.ScheduleDay = (m.ScheduleDay + 1) % 7
+	case "left":
+		m.ScheduleHour = (m.ScheduleHour + 23) % 24
+	case "right":
+		m.ScheduleHour = (m.ScheduleHour + 1) % 24
+	case " ":
+		m.ScheduleGrid[m.ScheduleDay][m.ScheduleHour] = !m.ScheduleGrid[m.ScheduleDay][m.ScheduleHour]
+	case "a":
+		// Toggle the whole day, turning it on unless it is all on already.
+		day := &m.ScheduleGrid[m.ScheduleDay]
+		all := true
+		for _, on := range day {
+			all = all && on
+		}
+		for hour := range day {
+			day[hour] = !all
+		}
+	case "enter":
+		if err := m.SaveSchedule(m.ScheduleGrid); err != nil {
+			m.Err = err
+			return m, nil
+		}
+		m.Err = nil
+		m.ShowSchedule = false
+		m.Notice = "Schedule saved"
+		if !m.ConfigSnapshot().AltSpeedSchedule {
+			m.Notice += ", turn it on in the config to follow it"
+		}
+	}
+	return m, nil
+}
+
+func (m *Model) scheduleView() string {
+	var s strings.Builder
+	s.WriteString(titleStyle.Render("Alternate Speed Schedule"))
+	s.WriteString("\n\n")
+
+	s.WriteString("     ")
+	for hour := 0; hour < 24; hour++ {
+		s.WriteString(fmt.Sprintf("%02d ", hour))
+	}
+	s.WriteString("\n")
+
+	for day := 0; day < 7; day++ {
+		s.WriteString(time.Weekday(day).String()[:3] + "  ")
+		for hour := 0; hour < 24; hour++ {
+			cell := " · "
+			if m.ScheduleGrid[day][hour] {
+				cell = " ■ "
+			}
+			if day == m.ScheduleDay && hour == m.ScheduleHour {
+				cell = selectedStyle.Render("[" + strings.TrimSpace(cell) + "]")
+			}
+			s.WriteString(cell)
+		}
+		s.WriteString("\n")
+	}
+
+	cfg := m.ConfigSnapshot()
+	down, up := cfg.AltDownloadLimit, cfg.AltUploadLimit
+	s.WriteString(fmt.Sprintf("\n■ alternate limits (↓ %s, ↑ %s) • · normal limits\n", formatLimit(down), formatLimit(up)))
+	s.WriteString("\nArrows to move, Space to toggle, 'a' toggle day, Enter to save, Esc to cancel")
+	return s.String()
+}
+
+// formatLimit shows a KB/s limit, where 0 means unlimited.
+func formatLimit(kbps int64) string {
+	if kbps <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d KB/s", kbps)
+}
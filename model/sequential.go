@@ -0,0 +1,112 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/anacrolix/torrent"
+)
+
+// sequentialWindow is how many of the next missing pieces are fetched ahead
+// of all others in sequential mode.
+const sequentialWindow = 16
+
+// SetSequential turns sequential mode of a torrent on or off. In sequential
+// mode pieces are fetched in file order, after the first and last piece of
+// every file, which media players read before anything else.
+func (m *Model) SetSequential(infoHash string, on bool) error {
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+
+	item, exists := m.Torrents[infoHash]
+	if !exists {
+		return fmt.Errorf("torrent %s not found", infoHash)
+	}
+	return m.setSequential(infoHash, item, on)
+}
+
+// ToggleSequential turns sequential mode of a torrent off if it is on, and on
+// otherwise. It returns whether it is on now.
+func (m *Model) ToggleSequential(infoHash string) (bool, error) {
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+
+	item, exists := m.Torrents[infoHash]
+	if !exists {
+		return false, fmt.Errorf("torrent %s not found", infoHash)
+	}
+	on := !item.Sequential
+	return on, m.setSequential(infoHash, item, on)
+}
+
+// setSequential is SetSequential for an item found under m.Mu, which the
+// caller holds.
+func (m *Model) setSequential(infoHash string, item *TorrentItem, on bool) error {
+	item.Sequential = on
+	if item.Torrent.Info() != nil {
+		if on {
+			applySequential(item.Torrent)
+		} else {
+			clearPiecePriorities(item.Torrent)
+		}
+	}
+
+	return m.SaveTorrentState(infoHash, item)
+}
+
+// applySequential raises the priority of the first and last piece of every
+// wanted file, and of the next missing pieces in file order. It is called
+// again as pieces complete, which moves the window forward.
+func applySequential(t *torrent.Torrent) {
+	window := 0
+	var boost []int
+	for _, f := range t.Files() {
+		begin, end := f.BeginPieceIndex(), f.EndPieceIndex()
+		if f.Priority() == torrent.PiecePriorityNone || begin == end {
+			continue
+		}
+		boost = append(boost, begin, end-1)
+
+		for i := begin; i < end && window < sequentialWindow; i++ {
+			if t.Piece(i).State().Complete {
+				continue
+			}
+			if i != begin && i != end-1 {
+				t.Piece(i).SetPriority(torrent.PiecePriorityHigh)
+			}
+			window++
+		}
+	}
+
+	for _, i := range boost {
+		if !t.Piece(i).State().Complete {
+			t.Piece(i).SetPriority(torrent.PiecePriorityReadahead)
+		}
+	}
+}
+
+// clearPiecePriorities drops the priorities set on single pieces, leaving
+// the file priorities in charge again.
+func clearPiecePriorities(t *torrent.Torrent) {
+	for i := 0; i < t.NumPieces(); i++ {
+		t.Piece(i).SetPriority(torrent.PiecePriorityNone)
+	}
+}
+
+func (m *Model) toggleSequential() {
+	m.Mu.RLock()
+	infoHash := m.selectedHash()
+	m.Mu.RUnlock()
+	if infoHash == "" {
+		return
+	}
+
+	on, err := m.ToggleSequential(infoHash)
+	if err != nil {
+		m.Err = err
+		return
+	}
+	m.Notice = "Sequential download off"
+	if on {
+		m.Notice = "Sequential download on"
+	}
+}
@@ -1,60 +1,184 @@
 package model
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 // Modify addTorrent method
 func (m *Model) AddTorrent(magnetURI string) {
-	t, err := m.Client.AddMagnet(magnetURI)
+	if _, err := m.AddMagnet(magnetURI); err != nil {
+		m.Err = err
+	}
+}
+
+// AddOptions are the choices that can be made when adding a torrent.
+type AddOptions struct {
+	// SavePath is the directory the data ends up below. If empty, it is
+	// chosen from the label and the configured directories.
+	SavePath string
+	Label    string
+	// Paused adds the torrent without starting its transfers. A magnet link
+	// still fetches its metadata.
+	Paused     bool
+	Sequential bool
+	// SkipHashCheck trusts data already in the save path to be complete
+	// instead of hashing it. It needs the metainfo, so magnet links ignore it.
+	SkipHashCheck bool
+	// SkipFiles are the indexes of the files not to download.
+	SkipFiles []int
+}
+
+// AddMagnet adds a magnet link and returns the info hash of its torrent.
+func (m *Model) AddMagnet(magnetURI string) (string, error) {
+	infoHash, _, err := m.AddMagnetWithOptions(magnetURI, AddOptions{})
+	return infoHash, err
+}
+
+// AddMagnetWithOptions is AddMagnet with a choice of where and how the
+// torrent is added. existed reports whether the torrent was in the session
+// already, in which case it is left as it is and opts are ignored.
+func (m *Model) AddMagnetWithOptions(magnetURI string, opts AddOptions) (infoHash string, existed bool, err error) {
+	var completedPath string
+	opts.SavePath, completedPath = m.downloadPaths(opts, nil)
+	return m.addMagnet(magnetURI, opts, completedPath, nil)
+}
+
+// addMagnet adds a magnet link to opts.SavePath, to be moved to
+// completedPath once complete if that is set. A torrent of an earlier
+// session gets what it had back from restore before it is saved.
+func (m *Model) addMagnet(magnetURI string, opts AddOptions, completedPath string, restore func(*TorrentItem)) (string, bool, error) {
+	spec, err := magnetSpec(magnetURI)
 	if err != nil {
-		m.Err = fmt.Errorf("failed to add magnet: %v", err)
-		return
+		return "", false, fmt.Errorf("failed to add magnet: %v", err)
+	}
+	if err := m.prepareAdd(spec, opts); err != nil {
+		return "", false, fmt.Errorf("failed to add magnet: %v", err)
+	}
+
+	t, err := m.addSpec(spec, opts.SavePath)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to add magnet: %v", err)
 	}
 
 	infoHash := t.InfoHash().String()
 
 	m.Mu.Lock()
-	m.Torrents[infoHash] = &TorrentItem{
+	if _, exists := m.Torrents[infoHash]; exists {
+		m.Mu.Unlock()
+		return infoHash, true, nil
+	}
+	item := &TorrentItem{
 		Name:       "Fetching metadata...",
 		Progress:   0,
 		Speed:      0,
 		State:      "fetching_metadata",
 		Torrent:    t,
 		MagnetURI:  magnetURI,
+		SavePath:   opts.SavePath,
+		Label:      opts.Label,
 		LastUpdate: time.Now(),
 		LastBytes:  0,
+		Sequential: opts.Sequential,
+
+		CompletedPath: completedPath,
+
+		QueuePosition: m.nextQueuePosition(),
 	}
+	if opts.Paused {
+		pauseItem(item)
+	}
+	if restore != nil {
+		restore(item)
+	}
+	m.Torrents[infoHash] = item
+	m.applyQueue()
+	err = m.SaveTorrentState(infoHash, item)
 	m.Mu.Unlock()
+	if err != nil {
+		return "", false, err
+	}
 
-	if err := m.SaveTorrentState(infoHash, m.Torrents[infoHash]); err != nil {
-		m.Err = err
-		return
+	go m.awaitInfo(infoHash, t)
+	return infoHash, false, nil
+}
+
+// magnetSpec parses a magnet link, which must name its torrent by info hash.
+func magnetSpec(magnetURI string) (*torrent.TorrentSpec, error) {
+	spec, err := torrent.TorrentSpecFromMagnetUri(magnetURI)
+	if err != nil {
+		return nil, err
 	}
+	if spec.InfoHash.IsZero() && !spec.InfoHashV2.Ok {
+		return nil, fmt.Errorf("no info hash in magnet link")
+	}
+	return spec, nil
+}
 
-	go func() {
-		select {
-		case <-t.GotInfo():
-			m.Mu.Lock()
-			if item, exists := m.Torrents[infoHash]; exists {
-				item.Name = t.Name()
-				item.State = "downloading"
-				m.SaveTorrentState(infoHash, item)
-				// Start downloading all files automatically
-				t.DownloadAll()
-			}
-			m.Mu.Unlock()
-		case <-time.After(30 * time.Second):
-			m.Mu.Lock()
-			delete(m.Torrents, infoHash)
-			m.Err = fmt.Errorf("timeout waiting for torrent info")
-			m.Mu.Unlock()
+// prepareAdd does what opts ask for before a torrent is added to the client.
+// Skipped files are saved for awaitInfo to apply, and with SkipHashCheck the
+// pieces are marked complete, so the client doesn't check them. Nothing is
+// done for torrents already in the session.
+func (m *Model) prepareAdd(spec *torrent.TorrentSpec, opts AddOptions) error {
+	infoHash := spec.InfoHash
+	if infoHash.IsZero() && spec.InfoHashV2.Ok {
+		infoHash = *spec.InfoHashV2.Value.ToShort()
+	}
+
+	m.Mu.RLock()
+	_, exists := m.Torrents[infoHash.HexString()]
+	m.Mu.RUnlock()
+	if exists {
+		return nil
+	}
+
+	for _, i := range opts.SkipFiles {
+		if err := m.SaveFilePriority(infoHash.HexString(), i, FilePrioritySkip); err != nil {
+			return err
+		}
+	}
+
+	if !opts.SkipHashCheck || spec.InfoBytes == nil {
+		return nil
+	}
+	var info metainfo.Info
+	if err := bencode.Unmarshal(spec.InfoBytes, &info); err != nil {
+		return err
+	}
+	completion := m.pieceCompletionFor(opts.SavePath)
+	for i := range info.NumPieces() {
+		if err := completion.Set(metainfo.PieceKey{InfoHash: infoHash, Index: i}, true); err != nil {
+			return err
 		}
-	}()
+	}
+	return nil
+}
+
+// addSpec adds a torrent to the client. Torrents stored outside the data
+// directory of the client get a storage of their own.
+func (m *Model) addSpec(spec *torrent.TorrentSpec, savePath string) (*torrent.Torrent, error) {
+	if savePath != m.dataDir() {
+		spec.Storage = m.storageFor(savePath)
+	}
+
+	t, _, err := m.Client.AddTorrentSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	t.SetMaxEstablishedConns(m.maxConnections())
+	return t, nil
 }
 
 // func (m *Model) AddTorrent(magnetURI string) {
@@ -105,61 +229,396 @@ func (m *Model) AddTorrent(magnetURI string) {
 // }
 
 func (m *Model) AddTorrentFromFile(torrentPath string) {
-	t, err := m.Client.AddTorrentFromFile(torrentPath)
+	f, err := os.Open(torrentPath)
 	if err != nil {
 		m.Err = fmt.Errorf("failed to add torrent: %v", err)
 		return
 	}
+	defer f.Close()
 
-	infoHash := t.InfoHash().String()
+	if _, err := m.AddMetainfo(f); err != nil {
+		m.Err = err
+	}
+}
+
+// AddMetainfo adds a torrent from the contents of a .torrent file and returns
+// its info hash.
+func (m *Model) AddMetainfo(r io.Reader) (string, error) {
+	infoHash, _, err := m.AddMetainfoWithOptions(r, AddOptions{})
+	return infoHash, err
+}
+
+// AddMetainfoWithOptions is AddMetainfo with a choice of where and how the
+// torrent is added. existed reports whether the torrent was in the session
+// already, in which case it is left as it is and opts are ignored.
+func (m *Model) AddMetainfoWithOptions(r io.Reader, opts AddOptions) (infoHash string, existed bool, err error) {
+	mi, err := metainfo.Load(r)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to add torrent: %v", err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to add torrent: %v", err)
+	}
+	var completedPath string
+	opts.SavePath, completedPath = m.downloadPaths(opts, &info)
+
+	spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to add torrent: %v", err)
+	}
+	if err := m.prepareAdd(spec, opts); err != nil {
+		return "", false, fmt.Errorf("failed to add torrent: %v", err)
+	}
+
+	t, err := m.addSpec(spec, opts.SavePath)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to add torrent: %v", err)
+	}
+
+	infoHash = t.InfoHash().String()
 
-	mi := t.Metainfo()
 	magnetURI, err := mi.MagnetV2()
 	if err != nil {
-		m.Err = fmt.Errorf("failed to generate magnet URI: %v", err)
-		return
+		return "", false, fmt.Errorf("failed to generate magnet URI: %v", err)
 	}
 
 	m.Mu.Lock()
-	m.Torrents[infoHash] = &TorrentItem{
-		Name:       filepath.Base(torrentPath),
+	if _, exists := m.Torrents[infoHash]; exists {
+		m.Mu.Unlock()
+		return infoHash, true, nil
+	}
+	item := &TorrentItem{
+		Name:       t.Name(),
 		Progress:   0,
 		Speed:      0,
 		State:      "connecting",
 		Torrent:    t,
 		MagnetURI:  magnetURI.String(),
+		SavePath:   opts.SavePath,
+		Label:      opts.Label,
 		LastUpdate: time.Now(),
 		LastBytes:  0,
+		Sequential: opts.Sequential,
+
+		CompletedPath: completedPath,
+
+		QueuePosition: m.nextQueuePosition(),
+	}
+	if opts.Paused {
+		pauseItem(item)
 	}
+	m.Torrents[infoHash] = item
+	m.applyQueue()
+	err = m.SaveTorrentState(infoHash, item)
 	m.Mu.Unlock()
+	if err != nil {
+		return "", false, err
+	}
 
-	if err := m.SaveTorrentState(infoHash, m.Torrents[infoHash]); err != nil {
-		m.Err = err
-		return
+	go m.awaitInfo(infoHash, t)
+	return infoHash, false, nil
+}
+
+// AddURL adds a torrent from a magnet link or from a .torrent file
+// downloaded over HTTP. existed is as for AddMetainfoWithOptions.
+func (m *Model) AddURL(u string, opts AddOptions) (infoHash string, existed bool, err error) {
+	if strings.HasPrefix(u, "magnet:") {
+		return m.AddMagnetWithOptions(u, opts)
 	}
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		return "", false, fmt.Errorf("unsupported URL %s", u)
+	}
+
+	resp, err := http.Get(u)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to fetch %s: %v", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("failed to fetch %s: %s", u, resp.Status)
+	}
+	return m.AddMetainfoWithOptions(resp.Body, opts)
+}
+
+// addStoredTorrent adds a torrent from metainfo saved by a previous session,
+// which gets what it had back from restore before it is saved. The info is
+// already known, so the torrent resumes without any peers.
+func (m *Model) addStoredTorrent(st storedTorrent, restore func(*TorrentItem)) error {
+	mi, err := metainfo.Load(bytes.NewReader(st.Metainfo))
+	if err != nil {
+		return fmt.Errorf("failed to load stored metainfo: %v", err)
+	}
+
+	spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+	if err != nil {
+		return fmt.Errorf("failed to load stored metainfo: %v", err)
+	}
+
+	t, err := m.addSpec(spec, st.SavePath)
+	if err != nil {
+		return fmt.Errorf("failed to add torrent: %v", err)
+	}
+
+	infoHash := t.InfoHash().String()
+
+	m.Mu.Lock()
+	item := &TorrentItem{
+		Name:       t.Name(),
+		Progress:   0,
+		Speed:      0,
+		State:      "connecting",
+		Torrent:    t,
+		MagnetURI:  st.MagnetURI,
+		SavePath:   st.SavePath,
+		Label:      st.Label,
+		LastUpdate: time.Now(),
+		LastBytes:  0,
+
+		CompletedPath: st.CompletedPath,
+	}
+	restore(item)
+	m.Torrents[infoHash] = item
+	m.applyQueue()
+	err = m.SaveTorrentState(infoHash, item)
+	m.Mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	go m.awaitInfo(infoHash, t)
+	return nil
+}
+
+// awaitInfo waits for the metadata of a torrent, then starts downloading it
+// and stores its metainfo so it never has to be fetched again. Metadata that
+// takes long is reported, but the torrent keeps waiting for it until it is
+// removed.
+func (m *Model) awaitInfo(infoHash string, t *torrent.Torrent) {
+	select {
+	case <-t.GotInfo():
+	case <-time.After(30 * time.Second):
+		m.Mu.Lock()
+		if item, exists := m.Torrents[infoHash]; exists && item.Torrent == t {
+			m.Err = fmt.Errorf("still waiting for the metadata of %s", infoHash)
+		}
+		m.Mu.Unlock()
 
-	go func() {
 		select {
 		case <-t.GotInfo():
-			m.Mu.Lock()
-			if item, exists := m.Torrents[infoHash]; exists {
-				item.Name = t.Name()
-				item.State = "downloading"
-				m.SaveTorrentState(infoHash, item)
-				t.DownloadAll()
-			}
-			m.Mu.Unlock()
-		case <-time.After(30 * time.Second):
-			m.Mu.Lock()
-			delete(m.Torrents, infoHash)
-			m.Err = fmt.Errorf("timeout waiting for torrent info")
-			m.Mu.Unlock()
+		case <-t.Closed():
+			return
+		}
+	}
+
+	m.Mu.Lock()
+	item, exists := m.Torrents[infoHash]
+	// The item may belong to another client by now, after a config change.
+	exists = exists && item.Torrent == t
+	if exists {
+		item.Name = t.Name()
+		if item.State == "paused" {
+			// A paused magnet link kept its peers for the metadata.
+			pauseItem(item)
+		} else if item.State != "verifying" && item.State != "queued" && item.State != "finished" {
+			item.State = "downloading"
+		}
+		m.SaveTorrentState(infoHash, item)
+		// Start downloading the selected files automatically
+		if err := m.applyFilePriorities(infoHash, t); err != nil {
+			m.Err = err
+		}
+		m.applyQueue()
+	}
+	m.Mu.Unlock()
+
+	if exists {
+		if err := m.SaveTorrentMetainfo(infoHash, t.Metainfo()); err != nil {
+			m.Err = err
+		}
+	}
+}
+
+// verifySeed hashes the data of a restored, previously completed torrent and
+// puts it back to seeding if everything is still on disk.
+func (m *Model) verifySeed(infoHash string) {
+	m.Mu.Lock()
+	item, exists := m.Torrents[infoHash]
+	if !exists {
+		m.Mu.Unlock()
+		return
+	}
+	item.State = "verifying"
+	if err := m.SaveTorrentState(infoHash, item); err != nil {
+		m.Err = err
+	}
+	t := item.Torrent
+	m.Mu.Unlock()
+
+	select {
+	case <-t.GotInfo():
+	case <-t.Closed():
+		return
+	case <-time.After(30 * time.Second):
+		return
+	}
+
+	t.VerifyData()
+
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+	if item, exists := m.Torrents[infoHash]; exists && item.State == "verifying" {
+		// Hand the torrent to the queue, which starts it again as a seed or
+		// a download when there is a free slot.
+		m.queueTorrent(infoHash, item)
+		m.applyQueue()
+	}
+}
+
+// PauseTorrent stops all transfers of a torrent and drops its peers.
+func (m *Model) PauseTorrent(infoHash string) error {
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+
+	item, exists := m.Torrents[infoHash]
+	if !exists {
+		return fmt.Errorf("torrent %s not found", infoHash)
+	}
+	if item.State == "moving" {
+		return fmt.Errorf("torrent %s is being moved", infoHash)
+	}
+
+	pauseItem(item)
+	return m.SaveTorrentState(infoHash, item)
+}
+
+// pauseItem stops all transfers of a torrent and drops its peers. A magnet
+// link still fetching its metadata keeps them, as it would time out without
+// it; awaitInfo drops them once the metadata has arrived.
+func pauseItem(item *TorrentItem) {
+	item.Torrent.DisallowDataDownload()
+	item.Torrent.DisallowDataUpload()
+	if item.Torrent.Info() != nil {
+		item.Torrent.SetMaxEstablishedConns(0)
+	}
+	item.State = "paused"
+	item.Speed = 0
+	item.UploadSpeed = 0
+}
+
+// ResumeTorrent allows a paused torrent to transfer data again, or queues it
+// if there is no free slot.
+func (m *Model) ResumeTorrent(infoHash string) error {
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+
+	item, exists := m.Torrents[infoHash]
+	if !exists {
+		return fmt.Errorf("torrent %s not found", infoHash)
+	}
+	if item.State != "paused" {
+		return nil
+	}
+
+	item.Torrent.SetMaxEstablishedConns(m.maxConnections())
+	item.Torrent.AllowDataDownload()
+	item.Torrent.AllowDataUpload()
+	item.State = "connecting"
+
+	if err := m.SaveTorrentState(infoHash, item); err != nil {
+		return err
+	}
+	m.applyQueue()
+	return nil
+}
+
+// RemoveTorrent drops a torrent from the session and forgets it. If deleteData
+// is set, the downloaded files are removed from disk as well.
+func (m *Model) RemoveTorrent(infoHash string, deleteData bool) error {
+	m.Mu.Lock()
+	item, exists := m.Torrents[infoHash]
+	if !exists {
+		m.Mu.Unlock()
+		return fmt.Errorf("torrent %s not found", infoHash)
+	}
+	if item.State == "moving" {
+		m.Mu.Unlock()
+		return fmt.Errorf("torrent %s is being moved", infoHash)
+	}
+	delete(m.Torrents, infoHash)
+	m.clampCursor()
+	m.Mu.Unlock()
+
+	info := item.Torrent.Info()
+	item.Torrent.Drop()
+
+	if deleteData && info != nil {
+		if err := os.RemoveAll(filepath.Join(item.SavePath, info.BestName())); err != nil {
+			return fmt.Errorf("failed to delete torrent data: %v", err)
 		}
-	}()
+	}
+
+	return m.DeleteTorrentState(infoHash)
+}
+
+// torrentHashes returns the info hashes of all torrents in queue order, which
+// is the order they are listed in.
+func (m *Model) torrentHashes() []string {
+	hashes := make([]string, 0, len(m.Torrents))
+	for infoHash := range m.Torrents {
+		hashes = append(hashes, infoHash)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		a, b := m.Torrents[hashes[i]], m.Torrents[hashes[j]]
+		if a.QueuePosition != b.QueuePosition {
+			return a.QueuePosition < b.QueuePosition
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return hashes[i] < hashes[j]
+	})
+	return hashes
+}
+
+// selectedHash returns the info hash of the torrent under the cursor.
+func (m *Model) selectedHash() string {
+	hashes := m.torrentHashes()
+	if m.Cursor < 0 || m.Cursor >= len(hashes) {
+		return ""
+	}
+	return hashes[m.Cursor]
+}
+
+func (m *Model) clampCursor() {
+	if m.Cursor >= len(m.Torrents) {
+		m.Cursor = len(m.Torrents) - 1
+	}
+	if m.Cursor < 0 {
+		m.Cursor = 0
+	}
 }
 
 type tickMsg struct{}
 
+// statsSaveInterval is how often the upload and seeding time of a seeding
+// torrent are persisted, as they change without any state transition.
+const statsSaveInterval = time.Minute
+
+// seedGoalReached reports whether a completed torrent has reached either
+// Config.SeedRatio or Config.SeedTime. A value of 0 disables that goal, so
+// with both at 0 torrents are seeded indefinitely.
+func (m *Model) seedGoalReached(item *TorrentItem) bool {
+	cfg := m.ConfigSnapshot()
+	if cfg.SeedRatio > 0 && item.Ratio() >= cfg.SeedRatio {
+		return true
+	}
+	if cfg.SeedTime > 0 && item.SeedingTime >= time.Duration(cfg.SeedTime)*time.Minute {
+		return true
+	}
+	return false
+}
+
 func (m *Model) UpdateTorrents() tea.Msg {
 	m.Mu.Lock()
 	defer m.Mu.Unlock()
@@ -168,7 +627,7 @@ func (m *Model) UpdateTorrents() tea.Msg {
 	needsUpdate := false
 
 	for infoHash, item := range m.Torrents {
-		if item.Torrent == nil {
+		if item.Torrent == nil || item.State == "moving" {
 			continue
 		}
 
@@ -179,7 +638,7 @@ func (m *Model) UpdateTorrents() tea.Msg {
 		item.TotalPeers = stats.TotalPeers
 		item.ActivePeers = stats.ActivePeers
 		item.Downloaded = bytesCompleted
-		item.Uploaded = stats.BytesWritten.Int64()
+		item.Uploaded = item.UploadedBase + stats.BytesWritten.Int64()
 
 		if totalLength > 0 {
 			newProgress := float64(bytesCompleted) / float64(totalLength) * 100
@@ -201,8 +660,15 @@ func (m *Model) UpdateTorrents() tea.Msg {
 		}
 
 		newState := item.State
-		if item.Torrent.Complete().Bool() {
-			newState = "completed"
+		if item.State == "finished" || item.State == "paused" || item.State == "verifying" || item.State == "queued" {
+			// Nothing changes until the user resumes, verification is done
+			// or the queue starts the torrent.
+		} else if downloadComplete(item.Torrent) {
+			newState = "seeding"
+			if m.seedGoalReached(item) {
+				newState = "finished"
+				item.Torrent.DisallowDataUpload()
+			}
 		} else if stats.ActivePeers > 0 && bytesCompleted < totalLength {
 			newState = "downloading"
 		} else if stats.TotalPeers == 0 {
@@ -220,15 +686,46 @@ func (m *Model) UpdateTorrents() tea.Msg {
 			}
 		}
 
-		item.LastBytes = bytesCompleted
-		item.LastUpdate = now
+		if item.CompletedPath != "" && (item.State == "seeding" || item.State == "finished") {
+			// The state before the move is the one the torrent is put back
+			// with.
+			st := storedTorrentFor(infoHash, item)
+			item.State = "moving"
+			item.Speed = 0
+			item.UploadSpeed = 0
+			needsUpdate = true
+			m.moveWG.Add(1)
+			go m.moveCompleted(infoHash, item.Torrent, st)
+			continue
+		}
+
+		if item.Sequential && item.State != "paused" && item.State != "queued" && item.Torrent.Info() != nil && !downloadComplete(item.Torrent) {
+			applySequential(item.Torrent)
+		}
 
-		uploadDiff := stats.BytesWritten.Int64() - item.LastBytes
+		if item.State == "seeding" {
+			item.SeedingTime += now.Sub(item.LastUpdate)
+			if now.Sub(item.LastSaved) >= statsSaveInterval {
+				item.LastSaved = now
+				if err := m.SaveTorrentState(infoHash, item); err != nil {
+					m.Err = err
+				}
+			}
+		}
+
+		uploaded := stats.BytesWritten.Int64()
 		if timeDiff := now.Sub(item.LastUpdate).Seconds(); timeDiff > 0 {
-			item.UploadSpeed = float64(uploadDiff) / timeDiff / 1024 / 1024
+			// The count starts over when the torrent is added to a new client.
+			item.UploadSpeed = float64(max(uploaded-item.LastUploaded, 0)) / timeDiff / 1024 / 1024
 		}
+
+		item.LastBytes = bytesCompleted
+		item.LastUploaded = uploaded
+		item.LastUpdate = now
 	}
 
+	m.applyQueue()
+
 	if needsUpdate {
 		return tickMsg{}
 	}
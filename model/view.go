@@ -3,6 +3,7 @@ package model
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"main/utils"
 
@@ -24,6 +25,10 @@ var (
 			Foreground(lipgloss.Color("#FF0000")).
 			MarginLeft(2)
 
+	selectedStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("#FF75B7"))
+
 	statusBarStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("#FFFFFF")).
 			Background(lipgloss.Color("#FF75B7")).
@@ -46,10 +51,30 @@ func (m *Model) View() string {
 			s.WriteString("\n")
 		}
 		s.WriteString("\nPress Enter to save, Esc to cancel")
+	} else if m.ShowDetails {
+		s.WriteString(m.detailsView())
+	} else if m.ShowFeeds {
+		s.WriteString(m.feedsView())
+	} else if m.ShowSchedule {
+		s.WriteString(m.scheduleView())
+	} else if m.ShowCreate {
+		s.WriteString(m.createView())
+	} else if m.ShowInspect {
+		s.WriteString(m.inspectView())
+	} else if m.ShowAdd {
+		s.WriteString(m.addView())
 	} else {
 		var content strings.Builder
-		for _, item := range m.Torrents {
-			content.WriteString(fmt.Sprintf("Name: %s\n", item.Name))
+		selectedLine := 0
+		for i, infoHash := range m.torrentHashes() {
+			item := m.Torrents[infoHash]
+			if i == m.Cursor {
+				selectedLine = strings.Count(content.String(), "\n")
+				content.WriteString(selectedStyle.Render(fmt.Sprintf("> Name: %s", item.Name)))
+				content.WriteString("\n")
+			} else {
+				content.WriteString(fmt.Sprintf("  Name: %s\n", item.Name))
+			}
 
 			progressWidth := m.Width - 8
 			if progressWidth < 20 {
@@ -69,8 +94,24 @@ func (m *Model) View() string {
 				item.Speed, item.UploadSpeed, item.ActivePeers, item.TotalPeers))
 			content.WriteString(fmt.Sprintf("Downloaded: %s • Uploaded: %s • Ratio: %.2f\n",
 				utils.FormatBytes(item.Downloaded), utils.FormatBytes(item.Uploaded),
-				float64(item.Uploaded)/float64(item.Downloaded+1)))
-			content.WriteString(fmt.Sprintf("State: %s\n", item.State))
+				item.Ratio()))
+			state := "State: " + item.State
+			if item.Sequential {
+				state += " • Sequential"
+			}
+			if item.State == "queued" {
+				state += fmt.Sprintf(" • Queue position %d", item.QueuePosition)
+			}
+			if item.SeedingTime > 0 {
+				state += fmt.Sprintf(" • Seeding for %s", item.SeedingTime.Round(time.Second))
+			}
+			if item.Label != "" {
+				state += " • Label: " + item.Label
+			}
+			if item.CompletedPath != "" {
+				state += " • Moves to " + item.CompletedPath
+			}
+			content.WriteString(state + "\n")
 
 			separatorWidth := m.Width - 4
 			if separatorWidth < 1 {
@@ -81,19 +122,47 @@ func (m *Model) View() string {
 		}
 
 		m.Viewport.SetContent(content.String())
+		m.scrollToLine(selectedLine, 6)
 		s.WriteString(m.Viewport.View())
 		s.WriteString("\n\n")
 		s.WriteString(m.TextInput.View())
 	}
 
+	if m.Notice != "" {
+		s.WriteString("\n")
+		s.WriteString(infoStyle.Render(m.Notice))
+	}
+
 	if m.Err != nil {
 		s.WriteString("\n")
 		s.WriteString(errorStyle.Render(m.Err.Error()))
 	}
 
-	statusBar := fmt.Sprintf(" %d torrents • Press 'c' for config • Press 'Tab' to switch between options • 'q' to quit", len(m.Torrents))
+	statusBar := fmt.Sprintf(" %d torrents", len(m.Torrents))
+	if m.ConfigSnapshot().AltSpeed {
+		statusBar += " • ALT SPEED"
+	}
+	download, upload := m.SpeedLimits()
+	if download > 0 {
+		statusBar += fmt.Sprintf(" • ↓ limit %d KB/s", download)
+	}
+	if upload > 0 {
+		statusBar += fmt.Sprintf(" • ↑ limit %d KB/s", upload)
+	}
+	statusBar += " • ↑/↓ select • 'p' pause • 'r' resume • 'd' remove • 'D' remove with data • 's' sequential • 'K'/'J' move up/down • 'T' move to top • 'A' alt speed • 'S' schedule • Enter details • 'f' files • 'R' feeds • 'n' create torrent • 'i' inspect • Press 'c' for config • Press 'Tab' to switch between options • 'q' to quit"
 	s.WriteString("\n")
 	s.WriteString(statusBarStyle.Render(statusBar))
 
 	return s.String()
 }
+
+// scrollToLine keeps the block of itemLines lines starting at line, which
+// holds the selected entry, inside the viewport.
+func (m *Model) scrollToLine(line, itemLines int) {
+	visible := m.Viewport.Height - m.Viewport.Style.GetVerticalFrameSize()
+	if line < m.Viewport.YOffset {
+		m.Viewport.SetYOffset(line)
+	} else if line+itemLines > m.Viewport.YOffset+visible {
+		m.Viewport.SetYOffset(line + itemLines - visible)
+	}
+}
@@ -0,0 +1,191 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// watchPollInterval is how often watch directories are scanned, which
+	// catches files that change notifications miss, e.g. on network shares.
+	watchPollInterval = 5 * time.Second
+	// watchSettleTime is how long a file found by a scan must be left alone
+	// before it is read, so files still being copied aren't picked up.
+	watchSettleTime = 2 * time.Second
+
+	watchAddedDir  = "added"
+	watchFailedDir = "failed"
+)
+
+// WatchDir is a directory new .torrent files are added from, with the
+// download directory and label they are added with.
+type WatchDir struct {
+	Path        string `json:"path"`
+	DownloadDir string `json:"download_dir"`
+	Label       string `json:"label"`
+}
+
+// parseWatchDirs reads watch directories in the form the config screen and
+// config table use: "dir|download dir|label" entries separated by ";", where
+// the download directory and label are optional.
+func parseWatchDirs(value string) []WatchDir {
+	var dirs []WatchDir
+	for _, entry := range strings.Split(value, ";") {
+		fields := strings.Split(entry, "|")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if fields[0] == "" {
+			continue
+		}
+
+		dir := WatchDir{Path: fields[0]}
+		if len(fields) > 1 {
+			dir.DownloadDir = fields[1]
+		}
+		if len(fields) > 2 {
+			dir.Label = fields[2]
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func formatWatchDirs(dirs []WatchDir) string {
+	entries := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		entry := dir.Path
+		if dir.DownloadDir != "" || dir.Label != "" {
+			entry += "|" + dir.DownloadDir
+		}
+		if dir.Label != "" {
+			entry += "|" + dir.Label
+		}
+		entries = append(entries, entry)
+	}
+	return strings.Join(entries, "; ")
+}
+
+// startWatching starts watching the configured watch directories.
+func (m *Model) startWatching() {
+	m.watchMu.Lock()
+	defer m.watchMu.Unlock()
+
+	m.watchStop = make(chan struct{})
+	for _, dir := range m.ConfigSnapshot().WatchDirs {
+		m.watchWG.Add(1)
+		go func(dir WatchDir) {
+			defer m.watchWG.Done()
+			m.watch(dir, m.watchStop)
+		}(dir)
+	}
+}
+
+// stopWatching stops all watch directories and waits until the files being
+// added are done.
+func (m *Model) stopWatching() {
+	m.watchMu.Lock()
+	defer m.watchMu.Unlock()
+
+	if m.watchStop != nil {
+		close(m.watchStop)
+		m.watchStop = nil
+	}
+	m.watchWG.Wait()
+}
+
+// watch adds the .torrent files that appear in dir until stop is closed.
+// Change notifications pick files up right away where they are available,
+// the periodic scan covers everything else.
+func (m *Model) watch(dir WatchDir, stop <-chan struct{}) {
+	for _, sub := range []string{watchAddedDir, watchFailedDir} {
+		if err := os.MkdirAll(filepath.Join(dir.Path, sub), 0o755); err != nil {
+			m.Err = fmt.Errorf("failed to watch %s: %v", dir.Path, err)
+			return
+		}
+	}
+
+	events, closeEvents, err := watchEvents(dir.Path)
+	if err == nil {
+		defer closeEvents()
+	}
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	m.scanWatchDir(dir)
+	for {
+		select {
+		case <-stop:
+			return
+		case name := <-events:
+			if isTorrentFile(name) {
+				m.addWatchedFile(dir, filepath.Join(dir.Path, name))
+			}
+		case <-ticker.C:
+			m.scanWatchDir(dir)
+		}
+	}
+}
+
+func isTorrentFile(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".torrent")
+}
+
+func (m *Model) scanWatchDir(dir WatchDir) {
+	entries, err := os.ReadDir(dir.Path)
+	if err != nil {
+		m.Err = fmt.Errorf("failed to scan watch directory: %v", err)
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !isTorrentFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < watchSettleTime {
+			continue
+		}
+		m.addWatchedFile(dir, filepath.Join(dir.Path, entry.Name()))
+	}
+}
+
+// addWatchedFile adds a .torrent file from a watch directory, then moves it
+// to the "added" or "failed" subdirectory so it is only tried once.
+func (m *Model) addWatchedFile(dir WatchDir, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		// Already moved by an earlier event or scan.
+		return
+	}
+	_, _, addErr := m.AddMetainfoWithOptions(f, AddOptions{SavePath: dir.DownloadDir, Label: dir.Label})
+	f.Close()
+
+	dest := watchAddedDir
+	if addErr != nil {
+		dest = watchFailedDir
+		m.Err = fmt.Errorf("failed to add %s: %v", filepath.Base(path), addErr)
+	}
+	if err := moveWatchedFile(path, filepath.Join(dir.Path, dest)); err != nil {
+		m.Err = err
+	}
+}
+
+// moveWatchedFile moves path into dir, renaming it if a file of that name
+// was handled before.
+func moveWatchedFile(path, dir string) error {
+	name := filepath.Base(path)
+	dest := filepath.Join(dir, name)
+	if _, err := os.Stat(dest); err == nil {
+		ext := filepath.Ext(name)
+		dest = filepath.Join(dir, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), time.Now().Unix(), ext))
+	}
+	if err := os.Rename(path, dest); err != nil {
+		return fmt.Errorf("failed to move %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// watchEvents reports the names of files written to or moved into dir, using
+// inotify. The returned function stops watching.
+func watchEvents(dir string) (<-chan string, func(), error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := syscall.InotifyAddWatch(fd, dir, syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO); err != nil {
+		syscall.Close(fd)
+		return nil, nil, err
+	}
+
+	// Reading through an *os.File lets Close wake up a pending read.
+	f := os.NewFile(uintptr(fd), "inotify")
+	names := make(chan string)
+	done := make(chan struct{})
+
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				start := offset + syscall.SizeofInotifyEvent
+				name := buf[start : start+int(event.Len)]
+				offset = start + int(event.Len)
+
+				select {
+				case names <- string(bytes.TrimRight(name, "\x00")):
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	return names, func() {
+		close(done)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package model
+
+import "errors"
+
+// watchEvents is only implemented with inotify; elsewhere watch directories
+// rely on scanning alone.
+func watchEvents(dir string) (<-chan string, func(), error) {
+	return nil, nil, errors.New("change notifications are not supported on this platform")
+}